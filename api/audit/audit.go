@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// All entries go to a global stream for admin queries, and are mirrored
+// into a per-plan stream so a plan's history can be read without
+// scanning everything. Streams are only ever appended to.
+const (
+	globalStream  = "audit:plans"
+	planStreamFmt = "audit:plan:%s"
+)
+
+func planStream(objectId string) string {
+	return fmt.Sprintf(planStreamFmt, objectId)
+}
+
+// Append queues an audit entry for a plan write on pipe, which should be
+// the transaction that makes the write, so the write and its entry are
+// stored together or not at all. before and after are the stored plan
+// documents around the write; either may be nil.
+func Append(ctx context.Context, pipe redis.Pipeliner, entry models.AuditEntry, before, after []byte) error {
+	diff, err := utils.DiffJSON(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to diff plan: %w", err)
+	}
+	if entry.Diff, err = json.Marshal(diff); err != nil {
+		return fmt.Errorf("failed to marshal diff: %w", err)
+	}
+	if entry.Timestamp == "" {
+		entry.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	for _, stream := range []string{globalStream, planStream(entry.ObjectId)} {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			Values: map[string]interface{}{"entry": data},
+		})
+	}
+	return nil
+}
+
+// ForPlan returns every audit entry recorded for a plan, oldest first.
+func ForPlan(ctx context.Context, objectId string) ([]models.AuditEntry, error) {
+	msgs, err := config.RedisClient.XRange(ctx, planStream(objectId), "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	return decode(msgs, "")
+}
+
+// Query reads the global stream. From and To map directly onto stream
+// IDs, which are millisecond based.
+func Query(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	start, end := streamBound(q.From, "-"), streamBound(q.To, "+")
+
+	var err error
+	var msgs []redis.XMessage
+	if q.Count > 0 && q.User == "" {
+		msgs, err = config.RedisClient.XRangeN(ctx, globalStream, start, end, q.Count).Result()
+	} else {
+		msgs, err = config.RedisClient.XRange(ctx, globalStream, start, end).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := decode(msgs, q.User)
+	if err != nil {
+		return nil, err
+	}
+	if q.Count > 0 && int64(len(entries)) > q.Count {
+		entries = entries[:q.Count]
+	}
+	return entries, nil
+}
+
+func streamBound(t time.Time, open string) string {
+	if t.IsZero() {
+		return open
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func decode(msgs []redis.XMessage, user string) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	for _, msg := range msgs {
+		raw, ok := msg.Values["entry"].(string)
+		if !ok {
+			continue
+		}
+		var entry models.AuditEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			return nil, fmt.Errorf("corrupt audit entry %s: %w", msg.ID, err)
+		}
+		if user != "" && entry.Subject != user && entry.Email != user {
+			continue
+		}
+		entry.ID = msg.ID
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,36 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+)
+
+// EventPublisher sends plan events to every subscriber.
+type EventPublisher interface {
+	Publish(ctx context.Context, events ...models.PlanMessage) error
+}
+
+// EventSubscriber hands events to handle until ctx is cancelled or the
+// subscription is lost, and returns why. Events of the same plan are
+// handled in the order they were published.
+type EventSubscriber interface {
+	Subscribe(ctx context.Context, handle Handler) error
+}
+
+// Handler processes one event. The context carries the trace and request
+// ID of the publisher. Returning an error asks for the event to be
+// delivered again where the implementation supports it.
+type Handler func(ctx context.Context, msg Message) error
+
+// Message is an event as a subscriber receives it.
+type Message struct {
+	Event models.PlanMessage
+
+	// PublishedAt is when the API published the event
+	PublishedAt time.Time
+
+	// Redelivered is set when an earlier delivery was not acknowledged
+	Redelivered bool
+}
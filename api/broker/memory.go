@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/logging"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	memoryDestination = "memory"
+	memoryQueueSize   = 1024
+)
+
+// ErrClosed is returned when publishing to a bus that has been closed.
+var ErrClosed = errors.New("event bus closed")
+
+// Memory is an in-process event bus for running the API and its event
+// handlers in one binary. Like the RabbitMQ exchange it copies every event
+// into each of its named queues: events published before anyone subscribes
+// are kept, subscribers to the same queue share its events, and a handler
+// error is logged rather than redelivered.
+type Memory struct {
+	mu     sync.RWMutex
+	closed bool
+	names  map[string]int
+	queues []chan delivery
+
+	// done is closed by Close to release publishers blocked on a full
+	// queue, and publishing counts the publishes still running
+	done       chan struct{}
+	publishing sync.WaitGroup
+}
+
+type delivery struct {
+	ctx context.Context
+	msg Message
+}
+
+// NewMemory creates a bus with the given queues.
+func NewMemory(queues ...string) *Memory {
+	m := &Memory{
+		names:  make(map[string]int, len(queues)),
+		queues: make([]chan delivery, len(queues)),
+		done:   make(chan struct{}),
+	}
+	for i, name := range queues {
+		m.names[name] = i
+		m.queues[i] = make(chan delivery, memoryQueueSize)
+	}
+	return m
+}
+
+// Publish copies the events into every queue, blocking while one is full.
+// The lock is only held to register the publish, so a slow subscriber
+// never holds up Close.
+func (m *Memory) Publish(ctx context.Context, events ...models.PlanMessage) error {
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		metrics.Published.WithLabelValues(memoryDestination, "failure").Add(float64(len(events)))
+		return ErrClosed
+	}
+	m.publishing.Add(1)
+	queues := m.queues
+	m.mu.RUnlock()
+	defer m.publishing.Done()
+
+	// Keep the trace and request ID but not the cancellation of the
+	// publishing request, which ends long before the event is handled
+	msgCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		msgCtx = logging.WithRequestID(msgCtx, requestID)
+	}
+
+	publishedAt := time.Now()
+	for i, event := range events {
+		for _, queue := range queues {
+			select {
+			case queue <- delivery{ctx: msgCtx, msg: Message{Event: event, PublishedAt: publishedAt}}:
+			case <-m.done:
+				metrics.Published.WithLabelValues(memoryDestination, "success").Add(float64(i))
+				metrics.Published.WithLabelValues(memoryDestination, "failure").Add(float64(len(events) - i))
+				return ErrClosed
+			}
+		}
+	}
+	metrics.Published.WithLabelValues(memoryDestination, "success").Add(float64(len(events)))
+	return nil
+}
+
+// Queue returns the subscriber side of a queue created by NewMemory.
+func (m *Memory) Queue(name string) EventSubscriber {
+	i, ok := m.names[name]
+	if !ok {
+		return memoryQueue(nil)
+	}
+	return memoryQueue(m.queues[i])
+}
+
+// Close stops publishing. Publishes blocked on a full queue fail with
+// ErrClosed, and subscribers return once they have handled the events
+// still queued.
+func (m *Memory) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	close(m.done)
+	m.publishing.Wait()
+	for _, queue := range m.queues {
+		close(queue)
+	}
+}
+
+type memoryQueue chan delivery
+
+// Subscribe handles events one at a time until ctx is cancelled or the bus
+// is closed and the queue drained.
+func (q memoryQueue) Subscribe(ctx context.Context, handle Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-q:
+			if !ok {
+				return nil
+			}
+			if err := handle(d.ctx, d.msg); err != nil {
+				slog.ErrorContext(d.ctx, "Failed to handle event", "eventId", d.msg.Event.EventId, "error", err)
+			}
+		}
+	}
+}
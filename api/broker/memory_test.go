@@ -0,0 +1,148 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/logging"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+)
+
+func event(objectId string, sequence int64) models.PlanMessage {
+	return models.PlanMessage{
+		EventId:   fmt.Sprintf("%s-%d", objectId, sequence),
+		Sequence:  sequence,
+		Operation: "patch",
+		Plan:      models.Plan{ObjectId: objectId},
+	}
+}
+
+// collect subscribes to queue until the bus is closed and returns the
+// sequence numbers it handled, in order.
+func collect(t *testing.T, queue EventSubscriber) []int64 {
+	t.Helper()
+	var got []int64
+	err := queue.Subscribe(context.Background(), func(ctx context.Context, msg Message) error {
+		got = append(got, msg.Event.Sequence)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	return got
+}
+
+func TestMemoryCopiesEventsIntoEveryQueue(t *testing.T) {
+	bus := NewMemory("indexer", "webhooks")
+
+	// Events published before anyone subscribes are kept
+	if err := bus.Publish(context.Background(), event("p1", 1), event("p1", 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(context.Background(), event("p1", 3)); err != nil {
+		t.Fatal(err)
+	}
+	bus.Close()
+
+	for _, name := range []string{"indexer", "webhooks"} {
+		got := collect(t, bus.Queue(name))
+		if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+			t.Errorf("queue %s handled %v, want [1 2 3]", name, got)
+		}
+	}
+}
+
+func TestMemoryPublishAfterClose(t *testing.T) {
+	bus := NewMemory("indexer")
+	bus.Close()
+	bus.Close() // closing twice is harmless
+
+	if err := bus.Publish(context.Background(), event("p1", 1)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() error = %v, want ErrClosed", err)
+	}
+}
+
+func TestMemoryCloseReleasesBlockedPublisher(t *testing.T) {
+	bus := NewMemory("indexer")
+	for i := 0; i < memoryQueueSize; i++ {
+		if err := bus.Publish(context.Background(), event("p1", 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The queue is full and nobody reads it, so this publish blocks
+	published := make(chan error, 1)
+	go func() {
+		published <- bus.Publish(context.Background(), event("p1", 2))
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() blocked behind a full queue")
+	}
+	if err := <-published; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Publish() error = %v, want ErrClosed", err)
+	}
+
+	// What was queued before Close is still handed out
+	if got := collect(t, bus.Queue("indexer")); len(got) != memoryQueueSize {
+		t.Errorf("handled %d events after Close, want %d", len(got), memoryQueueSize)
+	}
+}
+
+func TestMemoryPassesRequestIDButNotCancellation(t *testing.T) {
+	bus := NewMemory("indexer")
+
+	ctx, cancel := context.WithCancel(logging.WithRequestID(context.Background(), "req-1"))
+	if err := bus.Publish(ctx, event("p1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	bus.Close()
+
+	err := bus.Queue("indexer").Subscribe(context.Background(), func(ctx context.Context, msg Message) error {
+		if got := logging.RequestID(ctx); got != "req-1" {
+			t.Errorf("RequestID = %q, want req-1", got)
+		}
+		if ctx.Err() != nil {
+			t.Errorf("handler context is cancelled: %v", ctx.Err())
+		}
+		if msg.PublishedAt.IsZero() {
+			t.Error("PublishedAt is not set")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemorySubscribeStopsOnCancel(t *testing.T) {
+	bus := NewMemory("indexer")
+	defer bus.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var err error
+	go func() {
+		defer wg.Done()
+		err = bus.Queue("indexer").Subscribe(ctx, func(context.Context, Message) error { return nil })
+	}()
+	cancel()
+	wg.Wait()
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Subscribe() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DurationFromEnv reads a Go duration such as "30s" from the environment,
+// falling back when it is unset or invalid.
+func DurationFromEnv(name string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		slog.Warn("Ignoring invalid duration", "name", name, "value", v)
+	}
+	return fallback
+}
+
+// IntFromEnv reads a positive integer from the environment, falling back
+// when it is unset or invalid.
+func IntFromEnv(name string, fallback int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		slog.Warn("Ignoring invalid integer", "name", name, "value", v)
+	}
+	return fallback
+}
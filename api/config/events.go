@@ -0,0 +1,7 @@
+package config
+
+import "github.com/dumbresi/Healthcare-Plan-Management/api/broker"
+
+// Events is where the API publishes plan events: RabbitMQ, or an
+// in-process bus when EVENT_BUS=memory. main picks one at startup.
+var Events broker.EventPublisher
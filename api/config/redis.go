@@ -2,8 +2,10 @@ package config
 
 import (
 	"context"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/tracing"
 	"github.com/redis/go-redis/v9"
-	"log"
+	"log/slog"
 )
 
 var RedisClient *redis.Client
@@ -15,10 +17,15 @@ func InitRedis() {
 		Password: "",
 		DB:       0,
 	})
+	RedisClient.AddHook(metrics.RedisHook{})
+	RedisClient.AddHook(tracing.RedisHook{})
 
+	// The client reconnects on its own, so an unreachable Redis only keeps
+	// /readyz failing instead of stopping the process
 	_, err := RedisClient.Ping(Ctx).Result()
 	if err != nil {
-		log.Fatalf("Could not connect to Redis: %v", err)
+		slog.Warn("Could not connect to Redis, will keep retrying", "error", err)
+		return
 	}
-	log.Println("Connected to Redis successfully!")
+	slog.Info("Connected to Redis")
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/health"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/indexer"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defaultHealthAddr = ":8081"
+
+// consumerState is what the health server reports about the consumer
+// loops: a connection per queue, and the last message indexed.
+type consumerState struct {
+	mu              sync.Mutex
+	queues          map[string]*queueState
+	lastMessageAt   time.Time
+	lastOperation   string
+	lastObjectId    string
+	messagesHandled int64
+}
+
+type queueState struct {
+	connected   bool
+	connectedAt time.Time
+	lastError   string
+}
+
+func newConsumerState(queues ...string) *consumerState {
+	s := &consumerState{queues: make(map[string]*queueState, len(queues))}
+	for _, queue := range queues {
+		s.queues[queue] = &queueState{}
+	}
+	return s
+}
+
+func (s *consumerState) setConnected(queue string, connected bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[queue]
+	q.connected = connected
+	if connected {
+		q.connectedAt = time.Now()
+	}
+	if err != nil {
+		q.lastError = err.Error()
+	}
+}
+
+func (s *consumerState) processed(operation, objectId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastMessageAt = time.Now()
+	s.lastOperation = operation
+	s.lastObjectId = objectId
+	s.messagesHandled++
+}
+
+func (s *consumerState) queueCheck(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, q := range s.queues {
+		if !q.connected {
+			if q.lastError != "" {
+				return fmt.Errorf("not connected to queue %s: %s", name, q.lastError)
+			}
+			return fmt.Errorf("not connected to queue %s", name)
+		}
+	}
+	return nil
+}
+
+func (s *consumerState) details() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queues := map[string]interface{}{}
+	for name, q := range s.queues {
+		queue := map[string]interface{}{"connected": q.connected}
+		if !q.connectedAt.IsZero() {
+			queue["connectedAt"] = q.connectedAt.Format(time.RFC3339)
+		}
+		queues[name] = queue
+	}
+	details := map[string]interface{}{
+		"queues":          queues,
+		"messagesHandled": s.messagesHandled,
+	}
+	if !s.lastMessageAt.IsZero() {
+		details["lastMessage"] = map[string]interface{}{
+			"processedAt": s.lastMessageAt.Format(time.RFC3339),
+			"operation":   s.lastOperation,
+			"objectId":    s.lastObjectId,
+		}
+	}
+	return details
+}
+
+// serveHealth exposes /healthz, /readyz and /metrics on
+// CONSUMER_HEALTH_ADDR. The consumer is ready when it is connected to all
+// its queues, the plans index is available and Redis, where webhooks are
+// kept, is reachable.
+func serveHealth(state *consumerState, es *elasticsearch.Client) *http.Server {
+	addr := os.Getenv("CONSUMER_HEALTH_ADDR")
+	if addr == "" {
+		addr = defaultHealthAddr
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": health.StatusUp})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := health.Run(r.Context(), map[string]health.Check{
+			"queue": state.queueCheck,
+			"index": health.Elasticsearch(es, indexer.Index),
+			"redis": health.Redis(config.RedisClient),
+		})
+		report.Details = state.details()
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		slog.Info("Health server listening", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Health server stopped", "error", err)
+			os.Exit(1)
+		}
+	}()
+	return server
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/audit"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/middleware"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func GetPlanAudit(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+
+	entries, err := audit.ForPlan(ctx, id)
+	if err != nil {
+		return problem.Internal("Failed to retrieve audit trail", err)
+	}
+	if len(entries) == 0 {
+		return problem.NotFound(problem.CodeNotFound, "No audit entries for plan").WithObject(id)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(entries)
+}
+
+func QueryAudit(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	q := models.AuditQuery{User: c.Query("user")}
+
+	var err error
+	if q.From, err = queryTime(c, "from"); err != nil {
+		return err
+	}
+	if q.To, err = queryTime(c, "to"); err != nil {
+		return err
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 0 {
+			return problem.BadRequest(problem.CodeInvalidParameter, "limit must be a non-negative integer")
+		}
+		q.Count = n
+	}
+
+	entries, err := audit.Query(ctx, q)
+	if err != nil {
+		return problem.Internal("Failed to query audit trail", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(entries)
+}
+
+// queryTime parses an optional RFC 3339 query parameter, returning the zero
+// time when it is absent.
+func queryTime(c *fiber.Ctx, name string) (time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, problem.BadRequest(problem.CodeInvalidParameter, name+" must be an RFC 3339 timestamp").WithCause(err)
+	}
+	return t, nil
+}
+
+// queueAudit queues the audit entry for a plan write on pipe, the
+// transaction that makes the write, so no write is stored without its
+// entry.
+func queueAudit(ctx context.Context, pipe redis.Pipeliner, operation, objectId, beforeETag, afterETag string, before, after []byte) error {
+	subject, email := middleware.UserFromContext(ctx)
+	entry := models.AuditEntry{
+		Subject:    subject,
+		Email:      email,
+		Operation:  operation,
+		ObjectId:   objectId,
+		BeforeETag: beforeETag,
+		AfterETag:  afterETag,
+	}
+	return audit.Append(ctx, pipe, entry, before, after)
+}
@@ -0,0 +1,395 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/events"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/utils"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/versions"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	bulkBatchSize   = 200
+	bulkMaxLineSize = 1024 * 1024
+	bulkMaxRetries  = 3
+	bulkMaxBodySize = 64 * 1024 * 1024
+)
+
+var errBulkBodyTooLarge = fmt.Errorf("request body is larger than %d bytes", bulkMaxBodySize)
+
+// bulkItem is a validated plan waiting to be written, together with the
+// index of its entry in the report.
+type bulkItem struct {
+	result     int
+	plan       models.Plan
+	planJSON   []byte
+	etag       string
+	before     []byte
+	beforeETag string
+	status     string
+	seq        *redis.IntCmd
+}
+
+// bulkWriter accumulates validated plans and writes them to Redis a batch
+// at a time, filling in the report as it goes. In dry-run mode it only
+// works out what each write would do.
+type bulkWriter struct {
+	c        *fiber.Ctx
+	upsert   bool
+	dryRun   bool
+	report   *models.BulkReport
+	batch    []*bulkItem
+	inBatch  map[string]bool
+	messages []models.PlanMessage
+}
+
+func newBulkWriter(c *fiber.Ctx, mode string, dryRun bool) *bulkWriter {
+	return &bulkWriter{
+		c:       c,
+		upsert:  mode == "upsert",
+		dryRun:  dryRun,
+		report:  &models.BulkReport{Mode: mode, DryRun: dryRun, Results: []models.BulkResult{}},
+		inBatch: make(map[string]bool),
+	}
+}
+
+// BulkImportPlans loads many plans in one request. The body is NDJSON, one
+// plan per line, or CSV when sent as text/csv.
+func BulkImportPlans(c *fiber.Ctx) error {
+	mode := c.Query("mode", "create")
+	if mode != "create" && mode != "upsert" {
+		return problem.BadRequest(problem.CodeInvalidParameter, "mode must be create or upsert")
+	}
+
+	if c.Request().Header.ContentLength() > bulkMaxBodySize {
+		return problem.New(fiber.StatusRequestEntityTooLarge, problem.CodeRequestTooLarge, errBulkBodyTooLarge.Error())
+	}
+
+	w := newBulkWriter(c, mode, c.QueryBool("dryRun"))
+	body := bulkBody(c)
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv") {
+		importCSV(w, body)
+	} else {
+		importNDJSON(w, body)
+	}
+	w.flush()
+
+	if len(w.messages) > 0 {
+		if err := config.Events.Publish(c.UserContext(), w.messages...); err != nil {
+			slog.ErrorContext(c.UserContext(), "Failed to publish bulk import messages", "count", len(w.messages), "error", err)
+		}
+	}
+
+	report := w.report
+	for _, r := range report.Results {
+		switch r.Status {
+		case "created":
+			report.Created++
+		case "updated":
+			report.Updated++
+		case "unchanged":
+			report.Unchanged++
+		default:
+			report.Failed++
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// bulkBody reads the request body as it arrives when the server streams
+// it, so a large import is never held in memory whole. A chunked body has
+// no length to check up front, and fails with errBulkBodyTooLarge once it
+// passes the limit.
+func bulkBody(c *fiber.Ctx) io.Reader {
+	stream := c.Context().RequestBodyStream()
+	if stream == nil {
+		stream = bytes.NewReader(c.Body())
+	}
+	return &limitedReader{r: stream, n: bulkMaxBodySize}
+}
+
+// limitedReader is an io.LimitedReader that fails instead of ending the
+// body early, so a truncated import is not mistaken for a complete one.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBulkBodyTooLarge
+	}
+	// Read one byte past the limit to tell a body of exactly n bytes
+	// from a longer one
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), errBulkBodyTooLarge
+	}
+	return n, err
+}
+
+// fail records a line that could not be turned into a plan.
+func (w *bulkWriter) fail(line int, objectId, field, message string) {
+	w.report.Total++
+	w.report.Results = append(w.report.Results, models.BulkResult{
+		Line:     line,
+		ObjectId: objectId,
+		Status:   "invalid",
+		Field:    field,
+		Error:    message,
+	})
+}
+
+// failRows records a CSV plan that was skipped, with the problems found in
+// its rows nested under its one result.
+func (w *bulkWriter) failRows(line int, objectId string, errs []models.RowError) {
+	w.report.Total++
+	w.report.Results = append(w.report.Results, models.BulkResult{
+		Line:     line,
+		ObjectId: objectId,
+		Status:   "invalid",
+		Error:    "Plan skipped because of row errors",
+		Errors:   errs,
+	})
+}
+
+// add validates a plan and queues it for the next batch.
+func (w *bulkWriter) add(line int, plan models.Plan) {
+	// A line carries one result, so only the first invalid field is reported
+	if errs := validatePlan(plan); len(errs) > 0 {
+		w.fail(line, plan.ObjectId, errs[0].Field, errs[0].Message)
+		return
+	}
+
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		w.fail(line, plan.ObjectId, "", fmt.Sprintf("Failed to marshal plan object: %v", err))
+		return
+	}
+
+	w.report.Total++
+	w.report.Results = append(w.report.Results, models.BulkResult{Line: line, ObjectId: plan.ObjectId})
+
+	// A plan can only appear once per transaction
+	if w.inBatch[plan.ObjectId] || len(w.batch) == bulkBatchSize {
+		w.flush()
+	}
+	w.batch = append(w.batch, &bulkItem{
+		result:   len(w.report.Results) - 1,
+		plan:     plan,
+		planJSON: planJSON,
+		etag:     fmt.Sprintf("\"%x\"", sha256.Sum256(planJSON)),
+	})
+	w.inBatch[plan.ObjectId] = true
+}
+
+func importNDJSON(w *bulkWriter, body io.Reader) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), bulkMaxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var plan models.Plan
+		if err := json.Unmarshal(text, &plan); err != nil {
+			w.fail(line, "", "", fmt.Sprintf("Invalid JSON format: %v", err))
+			continue
+		}
+		w.add(line, plan)
+	}
+	if err := scanner.Err(); err != nil {
+		w.fail(line+1, "", "", fmt.Sprintf("Failed to read line: %v", err))
+	}
+}
+
+// flush writes the pending batch in one WATCH/MULTI transaction, retrying
+// if a concurrent writer touches one of its plans.
+func (w *bulkWriter) flush() {
+	ctx := w.c.UserContext()
+	if len(w.batch) == 0 {
+		return
+	}
+	defer func() {
+		w.batch = w.batch[:0]
+		w.inBatch = make(map[string]bool)
+	}()
+
+	ids := make([]string, 0, len(w.batch))
+	keys := make([]string, 0, 2*len(w.batch))
+	for _, item := range w.batch {
+		ids = append(ids, item.plan.ObjectId)
+		keys = append(keys, item.plan.ObjectId, item.plan.ObjectId+":etag")
+	}
+	author := currentAuthor(ctx)
+
+	if w.dryRun {
+		w.preview(ids)
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt < bulkMaxRetries; attempt++ {
+		err = config.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+			// keys holds each plan followed by its ETag
+			existing, err := tx.MGet(ctx, keys...).Result()
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i, item := range w.batch {
+					w.classify(item, existing[2*i])
+					item.beforeETag, _ = existing[2*i+1].(string)
+					if item.status != "created" && item.status != "updated" {
+						continue
+					}
+
+					pipe.Set(ctx, item.plan.ObjectId, item.planJSON, 0)
+					pipe.Set(ctx, item.plan.ObjectId+":etag", item.etag, 0)
+					item.seq = events.Next(ctx, pipe, item.plan.ObjectId)
+					if err := versions.Append(ctx, pipe, item.plan.ObjectId, item.etag, author, item.planJSON); err != nil {
+						return err
+					}
+					var err error
+					if item.status == "created" {
+						err = queueAudit(ctx, pipe, "create", item.plan.ObjectId, "", item.etag, nil, item.planJSON)
+					} else {
+						err = queueAudit(ctx, pipe, "replace", item.plan.ObjectId, item.beforeETag, item.etag, item.before, item.planJSON)
+					}
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			return err
+		}, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+
+	for _, item := range w.batch {
+		result := &w.report.Results[item.result]
+		if err != nil {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("Failed to store plan in Redis: %v", err)
+			continue
+		}
+
+		result.Status = item.status
+		switch item.status {
+		case "conflict":
+			result.Error = "Plan already exists"
+		case "created":
+			result.ETag = item.etag
+			w.messages = append(w.messages, events.New("create", item.plan, item.etag, author, item.seq.Val()))
+		case "updated":
+			result.ETag = item.etag
+			w.messages = append(w.messages, events.New("patch", item.plan, item.etag, author, item.seq.Val()))
+		case "unchanged":
+			result.ETag = item.etag
+		}
+	}
+}
+
+// classify works out what writing item would do given the currently
+// stored value, which is nil when the plan does not exist.
+func (w *bulkWriter) classify(item *bulkItem, existing interface{}) {
+	item.before = nil
+	if val, ok := existing.(string); ok {
+		item.before = []byte(val)
+	}
+
+	switch {
+	case item.before != nil && !w.upsert:
+		item.status = "conflict"
+	case bytes.Equal(item.before, item.planJSON):
+		item.status = "unchanged"
+	case item.before != nil:
+		item.status = "updated"
+	default:
+		item.status = "created"
+	}
+}
+
+// preview fills in the report for a dry run, including a diff for every
+// plan that would be updated.
+func (w *bulkWriter) preview(ids []string) {
+	ctx := w.c.UserContext()
+	existing, err := config.RedisClient.MGet(ctx, ids...).Result()
+
+	for i, item := range w.batch {
+		result := &w.report.Results[item.result]
+		if err != nil {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("Failed to read plan from Redis: %v", err)
+			continue
+		}
+
+		w.classify(item, existing[i])
+		result.Status = item.status
+		switch item.status {
+		case "conflict":
+			result.Error = "Plan already exists"
+		case "updated":
+			var before models.Plan
+			if json.Unmarshal(item.before, &before) == nil {
+				diff := utils.DiffPlans(before, item.plan)
+				result.Diff = &diff
+			}
+		}
+	}
+}
+
+func ExportPlans(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	if c.Query("format") == "csv" {
+		return exportCSV(c)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="plans.ndjson"`)
+
+	// Stream straight from the Redis scan so large exports are never held
+	// in memory
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := forEachPlan(ctx, func(_ models.Plan, raw string) error {
+			if _, err := w.WriteString(raw); err != nil {
+				return err
+			}
+			if err := w.WriteByte('\n'); err != nil {
+				return err
+			}
+			return w.Flush()
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Plan export aborted", "error", err)
+		}
+	})
+
+	return nil
+}
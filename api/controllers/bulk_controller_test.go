@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+)
+
+// ndjson encodes plans one per line.
+func ndjson(t *testing.T, plans ...models.Plan) string {
+	t.Helper()
+	var b strings.Builder
+	for _, plan := range plans {
+		data, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestBulkImportPlans(t *testing.T) {
+	changed := testPlan("plan-1")
+	changed.CreationDate = "01-01-2024"
+
+	tests := []struct {
+		name     string
+		query    string
+		existing []models.Plan
+		body     func(t *testing.T) string
+		want     []string
+		stored   map[string]string
+		events   []string
+	}{
+		{
+			name:     "create mode reports a conflict for a stored plan",
+			existing: []models.Plan{testPlan("plan-1")},
+			body:     func(t *testing.T) string { return ndjson(t, changed, testPlan("plan-2")) },
+			want:     []string{"conflict", "created"},
+			stored:   map[string]string{"plan-1": "12-12-2017", "plan-2": "12-12-2017"},
+			events:   []string{"create"},
+		},
+		{
+			name:   "a plan repeated in one batch conflicts with itself in create mode",
+			body:   func(t *testing.T) string { return ndjson(t, testPlan("plan-1"), changed) },
+			want:   []string{"created", "conflict"},
+			stored: map[string]string{"plan-1": "12-12-2017"},
+			events: []string{"create"},
+		},
+		{
+			name:   "a plan repeated in one batch is updated in upsert mode",
+			query:  "?mode=upsert",
+			body:   func(t *testing.T) string { return ndjson(t, testPlan("plan-1"), changed) },
+			want:   []string{"created", "updated"},
+			stored: map[string]string{"plan-1": "01-01-2024"},
+			events: []string{"create", "patch"},
+		},
+		{
+			name:     "upsert leaves an identical plan unchanged",
+			query:    "?mode=upsert",
+			existing: []models.Plan{testPlan("plan-1")},
+			body:     func(t *testing.T) string { return ndjson(t, testPlan("plan-1")) },
+			want:     []string{"unchanged"},
+			stored:   map[string]string{"plan-1": "12-12-2017"},
+		},
+		{
+			name:     "dry run writes nothing",
+			query:    "?mode=upsert&dryRun=true",
+			existing: []models.Plan{testPlan("plan-1")},
+			body:     func(t *testing.T) string { return ndjson(t, changed, testPlan("plan-2")) },
+			want:     []string{"updated", "created"},
+			stored:   map[string]string{"plan-1": "12-12-2017"},
+		},
+		{
+			name:   "invalid lines are reported and skipped",
+			body:   func(t *testing.T) string { return "{\n" + ndjson(t, testPlan("plan-1")) },
+			want:   []string{"invalid", "created"},
+			stored: map[string]string{"plan-1": "12-12-2017"},
+			events: []string{"create"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := setupStore(t)
+			ctx := context.Background()
+			for _, plan := range tt.existing {
+				if _, err := createPlan(ctx, plan); err != nil {
+					t.Fatal(err)
+				}
+			}
+			published := len(events.operations())
+
+			report := importBody(t, bulkApp(), tt.query, "application/x-ndjson", tt.body(t))
+			var statuses []string
+			for _, r := range report.Results {
+				statuses = append(statuses, r.Status)
+			}
+			if !slices.Equal(statuses, tt.want) {
+				t.Errorf("statuses = %v, want %v", statuses, tt.want)
+			}
+
+			for _, id := range []string{"plan-1", "plan-2"} {
+				plan, _, err := loadStoredPlan(ctx, id)
+				want, ok := tt.stored[id]
+				switch {
+				case ok && err != nil:
+					t.Errorf("%s not stored: %v", id, err)
+				case ok && plan.CreationDate != want:
+					t.Errorf("%s creationDate = %q, want %q", id, plan.CreationDate, want)
+				case !ok && err == nil:
+					t.Errorf("%s stored, want it missing", id)
+				}
+			}
+
+			if ops := events.operations()[published:]; !slices.Equal(ops, tt.events) {
+				t.Errorf("published %v, want %v", ops, tt.events)
+			}
+		})
+	}
+}
+
+func TestBulkImportDryRunDiff(t *testing.T) {
+	setupStore(t)
+	if _, err := createPlan(context.Background(), testPlan("plan-1")); err != nil {
+		t.Fatal(err)
+	}
+	changed := testPlan("plan-1")
+	changed.CreationDate = "01-01-2024"
+
+	report := importBody(t, bulkApp(), "?mode=upsert&dryRun=true", "application/x-ndjson", ndjson(t, changed))
+	if !report.DryRun || len(report.Results) != 1 {
+		t.Fatalf("report = %+v, want one dry-run result", report)
+	}
+	diff := report.Results[0].Diff
+	if diff == nil || len(diff.Plan) != 1 || diff.Plan[0].Field != "creationDate" {
+		t.Errorf("diff = %+v, want the creationDate change", diff)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		limit   int64
+		wantErr error
+	}{
+		{"shorter than the limit", "abc", 4, nil},
+		{"exactly the limit", "abcd", 4, nil},
+		{"past the limit", "abcde", 4, errBulkBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := io.ReadAll(&limitedReader{r: strings.NewReader(tt.body), n: tt.limit})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.wantErr)
+			}
+			if int64(len(data)) > tt.limit {
+				t.Errorf("read %d bytes, want at most %d", len(data), tt.limit)
+			}
+		})
+	}
+}
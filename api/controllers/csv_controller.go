@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The CSV format has one row per linked plan service. Plan level columns
+// are repeated on every row of a plan and must agree. Every object has its
+// own org and objectType column so an export imports back unchanged.
+var csvColumns = []string{
+	"planObjectId",
+	"planOrg",
+	"planCreationDate",
+	"planCostSharesObjectId",
+	"planCostSharesOrg",
+	"planCopay",
+	"planDeductible",
+	"linkedPlanServiceObjectId",
+	"linkedPlanServiceOrg",
+	"serviceObjectId",
+	"serviceName",
+	"serviceOrg",
+	"planserviceCostSharesObjectId",
+	"planserviceCostSharesOrg",
+	"copay",
+	"deductible",
+}
+
+// csvTypeColumns hold the objectType of each child object. Files written
+// before they were exported do not have them, so they are optional on
+// import and default to the types below.
+var csvTypeColumns = []string{
+	"planCostSharesObjectType",
+	"linkedPlanServiceObjectType",
+	"serviceObjectType",
+	"planserviceCostSharesObjectType",
+}
+
+// Default object types, for a missing or empty objectType column. Only
+// plans are listed, so the plan itself is always a plan.
+const (
+	planObjectType                  = "plan"
+	planCostSharesObjectType        = "membercostshare"
+	linkedPlanServiceObjectType     = "planservice"
+	linkedServiceObjectType         = "service"
+	planServiceCostSharesObjectType = "membercostshare"
+)
+
+func exportCSV(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="plans.csv"`)
+
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		w := csv.NewWriter(bw)
+		if err := w.Write(slices.Concat(csvColumns, csvTypeColumns)); err != nil {
+			slog.ErrorContext(ctx, "Plan CSV export aborted", "error", err)
+			return
+		}
+
+		err := forEachPlan(ctx, func(plan models.Plan, _ string) error {
+			var costShares models.PlanCostShares
+			if plan.PlanCostShares != nil {
+				costShares = *plan.PlanCostShares
+			}
+			for _, service := range plan.LinkedPlanServices {
+				err := writeCSVRow(w, []string{
+					plan.ObjectId,
+					plan.Org,
+					plan.CreationDate,
+					costShares.ObjectId,
+					costShares.Org,
+					strconv.Itoa(costShares.Copay),
+					strconv.Itoa(costShares.Deductible),
+					service.ObjectId,
+					service.Org,
+					service.LinkedService.ObjectId,
+					service.LinkedService.Name,
+					service.LinkedService.Org,
+					service.PlanServiceCostShares.ObjectId,
+					service.PlanServiceCostShares.Org,
+					strconv.Itoa(service.PlanServiceCostShares.Copay),
+					strconv.Itoa(service.PlanServiceCostShares.Deductible),
+					costShares.ObjectType,
+					service.ObjectType,
+					service.LinkedService.ObjectType,
+					service.PlanServiceCostShares.ObjectType,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			w.Flush()
+			return w.Error()
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Plan CSV export aborted", "error", err)
+		}
+	})
+
+	return nil
+}
+
+// csvFormulaPrefixes start a cell that a spreadsheet would evaluate as a
+// formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// writeCSVRow writes a row with every cell that a spreadsheet would take
+// for a formula quoted by a leading apostrophe, so a service name such as
+// =HYPERLINK(...) opens as text. importCSV strips the apostrophe again.
+func writeCSVRow(w *csv.Writer, row []string) error {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return w.Write(row)
+}
+
+// unquoteCSVCell undoes the apostrophe writeCSVRow puts before a formula.
+func unquoteCSVCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// csvPlan is a plan being assembled from its rows, together with the
+// problems found in them.
+type csvPlan struct {
+	line int
+	plan models.Plan
+	errs []models.RowError
+}
+
+// importCSV groups rows by plan objectId back into plans and hands them to
+// the bulk writer. Row problems are collected against the row and column
+// and cause the whole plan to be skipped with a single result.
+func importCSV(w *bulkWriter, body io.Reader) {
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		w.fail(1, "", "", fmt.Sprintf("Failed to read CSV header: %v", err))
+		return
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := index[name]; !ok {
+			w.fail(1, "", name, "Missing CSV column")
+			return
+		}
+	}
+
+	var order []string
+	plans := make(map[string]*csvPlan)
+
+	line := 1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			w.fail(line, "", "", fmt.Sprintf("Invalid CSV row: %v", err))
+			continue
+		}
+		if err != nil {
+			// Any plan may have rows that were never read, so none is
+			// imported
+			w.fail(line, "", "", fmt.Sprintf("Failed to read row: %v", err))
+			return
+		}
+
+		get := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return unquoteCSVCell(strings.TrimSpace(record[i]))
+			}
+			return ""
+		}
+		getType := func(name, fallback string) string {
+			if v := get(name); v != "" {
+				return v
+			}
+			return fallback
+		}
+
+		planId := get("planObjectId")
+		if planId == "" {
+			w.fail(line, "", "planObjectId", "ObjectId is required")
+			continue
+		}
+
+		var rowErrs []models.RowError
+		getInt := func(name string) int {
+			v := get(name)
+			if v == "" {
+				return 0
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				rowErrs = append(rowErrs, models.RowError{Line: line, Field: name, Message: fmt.Sprintf("%q is not a whole number", v)})
+			}
+			return n
+		}
+
+		planCopay := getInt("planCopay")
+		planDeductible := getInt("planDeductible")
+		copay := getInt("copay")
+		deductible := getInt("deductible")
+
+		p, seen := plans[planId]
+		if !seen {
+			p = &csvPlan{line: line}
+			p.plan = models.Plan{
+				ObjectId:     planId,
+				ObjectType:   planObjectType,
+				Org:          get("planOrg"),
+				CreationDate: get("planCreationDate"),
+				PlanCostShares: &models.PlanCostShares{
+					ObjectId:   get("planCostSharesObjectId"),
+					ObjectType: getType("planCostSharesObjectType", planCostSharesObjectType),
+					Org:        get("planCostSharesOrg"),
+					Copay:      planCopay,
+					Deductible: planDeductible,
+				},
+			}
+			plans[planId] = p
+			order = append(order, planId)
+		}
+		// Once a plan is skipped its later rows are only checked for
+		// their own bad cells, not compared against a broken first row
+		p.errs = append(p.errs, rowErrs...)
+		if len(p.errs) > 0 {
+			continue
+		}
+
+		// Plan level columns must be identical on every row of the plan
+		costShares := p.plan.PlanCostShares
+		for _, check := range []struct {
+			field string
+			same  bool
+		}{
+			{"planOrg", get("planOrg") == p.plan.Org},
+			{"planCreationDate", get("planCreationDate") == p.plan.CreationDate},
+			{"planCostSharesObjectId", get("planCostSharesObjectId") == costShares.ObjectId},
+			{"planCostSharesOrg", get("planCostSharesOrg") == costShares.Org},
+			{"planCostSharesObjectType", getType("planCostSharesObjectType", planCostSharesObjectType) == costShares.ObjectType},
+			{"planCopay", planCopay == costShares.Copay},
+			{"planDeductible", planDeductible == costShares.Deductible},
+		} {
+			if !check.same {
+				p.errs = append(p.errs, models.RowError{Line: line, Field: check.field, Message: fmt.Sprintf("Conflicts with row %d of the same plan", p.line)})
+			}
+		}
+		if len(p.errs) > 0 {
+			continue
+		}
+
+		p.plan.LinkedPlanServices = append(p.plan.LinkedPlanServices, models.LinkedPlanService{
+			ObjectId:   get("linkedPlanServiceObjectId"),
+			ObjectType: getType("linkedPlanServiceObjectType", linkedPlanServiceObjectType),
+			Org:        get("linkedPlanServiceOrg"),
+			LinkedService: models.LinkedService{
+				ObjectId:   get("serviceObjectId"),
+				ObjectType: getType("serviceObjectType", linkedServiceObjectType),
+				Name:       get("serviceName"),
+				Org:        get("serviceOrg"),
+			},
+			PlanServiceCostShares: models.PlanServiceCostShares{
+				ObjectId:   get("planserviceCostSharesObjectId"),
+				ObjectType: getType("planserviceCostSharesObjectType", planServiceCostSharesObjectType),
+				Copay:      copay,
+				Deductible: deductible,
+				Org:        get("planserviceCostSharesOrg"),
+			},
+		})
+	}
+
+	for _, planId := range order {
+		p := plans[planId]
+		if len(p.errs) > 0 {
+			w.failRows(p.line, planId, p.errs)
+			continue
+		}
+		w.add(p.line, p.plan)
+	}
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+// bulkApp serves the bulk import and export handlers.
+func bulkApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.Handler})
+	app.Post("/plans/bulk", BulkImportPlans)
+	app.Get("/plans/export", ExportPlans)
+	return app
+}
+
+// importBody posts body to the bulk import and returns its report.
+func importBody(t *testing.T, app *fiber.App, query, contentType, body string) models.BulkReport {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/plans/bulk"+query, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		t.Fatalf("import status = %d: %s", resp.StatusCode, data)
+	}
+	var report models.BulkReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	setupStore(t)
+	ctx := context.Background()
+	app := bulkApp()
+
+	plan := testPlan("plan-1")
+	plan.PlanCostShares.ObjectType = "costshare"
+	plan.LinkedPlanServices[0].LinkedService.Name = `=HYPERLINK("http://example.com","Yearly physical")`
+	plan.LinkedPlanServices[0].LinkedService.ObjectType = "labservice"
+	plan.LinkedPlanServices = append(plan.LinkedPlanServices, testPlan("plan-1-dental").LinkedPlanServices[0])
+	plan.LinkedPlanServices[1].LinkedService.Name = "@dental"
+	if _, err := createPlan(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/plans/export?format=csv", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(string(exported))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("exported %d rows, want a header and 2 rows:\n%s", len(rows), exported)
+	}
+	column := make(map[string]int)
+	for i, name := range rows[0] {
+		column[name] = i
+	}
+	// Cells a spreadsheet would evaluate are quoted
+	for i, want := range []string{`'=HYPERLINK("http://example.com","Yearly physical")`, "'@dental"} {
+		if got := rows[i+1][column["serviceName"]]; got != want {
+			t.Errorf("row %d serviceName = %q, want %q", i+1, got, want)
+		}
+	}
+
+	// Import the export into an empty store
+	setupStore(t)
+	report := importBody(t, app, "", "text/csv", string(exported))
+	if report.Created != 1 || report.Failed != 0 {
+		t.Fatalf("import report = %+v, want 1 created", report)
+	}
+
+	got, _, err := loadStoredPlan(ctx, "plan-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, plan) {
+		t.Errorf("imported plan = %+v, want %+v", got, plan)
+	}
+}
+
+func TestCSVImportDefaultsObjectTypes(t *testing.T) {
+	setupStore(t)
+	ctx := context.Background()
+
+	// A file exported before the objectType columns existed
+	body := strings.Join(csvColumns, ",") + "\n" +
+		"plan-1,example.com,12-12-2017,plan-1-costs,example.com,23,2000," +
+		"plan-1-service,example.com,plan-1-checkup,Yearly physical,example.com,plan-1-service-costs,example.com,0,0\n"
+	report := importBody(t, bulkApp(), "", "text/csv", body)
+	if report.Created != 1 {
+		t.Fatalf("import report = %+v, want 1 created", report)
+	}
+
+	got, _, err := loadStoredPlan(ctx, "plan-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testPlan("plan-1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported plan = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/utils"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/versions"
+	"github.com/gofiber/fiber/v2"
+)
+
+func DiffPlanVersions(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+	from, to := c.Query("from"), c.Query("to")
+
+	// Default to comparing the latest version with the one before it
+	if to == "" {
+		count, err := versions.Count(ctx, id)
+		if err != nil {
+			return problem.Internal("Failed to retrieve plan versions", err)
+		}
+		to = strconv.FormatInt(count, 10)
+	}
+
+	right, err := versions.Resolve(ctx, id, to)
+	if errors.Is(err, versions.ErrNotFound) {
+		return problem.NotFound(problem.CodeVersionNotFound, fmt.Sprintf("Version %s not found", to)).WithObject(id)
+	} else if err != nil {
+		return problem.Internal("Failed to retrieve plan version", err)
+	}
+
+	if from == "" {
+		if right.Version < 2 {
+			return problem.BadRequest(problem.CodeInvalidParameter, "No earlier version to compare with").WithObject(id)
+		}
+		from = strconv.FormatInt(right.Version-1, 10)
+	}
+
+	left, err := versions.Resolve(ctx, id, from)
+	if errors.Is(err, versions.ErrNotFound) {
+		return problem.NotFound(problem.CodeVersionNotFound, fmt.Sprintf("Version %s not found", from)).WithObject(id)
+	} else if err != nil {
+		return problem.Internal("Failed to retrieve plan version", err)
+	}
+
+	diff := utils.DiffPlans(versionPlan(left), versionPlan(right))
+	diff.Left = strconv.FormatInt(left.Version, 10)
+	diff.Right = strconv.FormatInt(right.Version, 10)
+
+	return c.Status(fiber.StatusOK).JSON(diff)
+}
+
+func DiffPlans(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	leftId, rightId := c.Query("left"), c.Query("right")
+	if leftId == "" || rightId == "" {
+		return problem.BadRequest(problem.CodeInvalidParameter, "Both left and right plan IDs are required")
+	}
+
+	left, _, err := loadStoredPlan(ctx, leftId)
+	if err != nil {
+		return err
+	}
+
+	right, _, err := loadStoredPlan(ctx, rightId)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.DiffPlans(left, right))
+}
+
+// versionPlan returns the snapshot of a version, or an empty plan for a
+// deletion marker so a delete diffs as everything removed.
+func versionPlan(v models.PlanVersion) models.Plan {
+	if v.Plan == nil {
+		return models.Plan{}
+	}
+	return *v.Plan
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/redis/go-redis/v9"
+)
+
+// errPlanExists is returned from inside the create transaction so the
+// handler can pick between 409 and 412 from the request headers.
+var errPlanExists = errors.New("plan already exists")
+
+func planNotFound(id string) *problem.Problem {
+	return problem.NotFound(problem.CodePlanNotFound, "Plan not found").WithObject(id)
+}
+
+// txProblem maps the error of a Redis WATCH transaction onto the response.
+// Problems raised inside the transaction pass through, and an aborted EXEC
+// means another writer changed the plan first.
+func txProblem(err error, id, modified, failed string) error {
+	var p *problem.Problem
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &p):
+		return p
+	case errors.Is(err, redis.TxFailedErr):
+		return problem.PreconditionFailed(modified).WithObject(id)
+	default:
+		return problem.Internal(failed, err)
+	}
+}
+
+// etagMatches compares an If-Match value against a stored ETag. Clients
+// send the ETag both with and without the surrounding quotes.
+func etagMatches(header, stored string) bool {
+	if header == "*" {
+		return true
+	}
+	return strings.Trim(header, "\"") == strings.Trim(stored, "\"")
+}
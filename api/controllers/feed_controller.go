@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/feed"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	feedHeartbeat  = 15 * time.Second
+	feedRetryDelay = 3 * time.Second
+)
+
+// StreamPlanEvents streams plan changes as Server-Sent Events, one per
+// event named after its type. A client that reconnects with Last-Event-ID
+// first gets what it missed; when that is no longer in the feed it gets a
+// reset event instead and should reload the plans it cares about.
+// ?objectId and ?org, repeated or comma separated, narrow the stream.
+func StreamPlanEvents(c *fiber.Ctx) error {
+	filter := feed.Filter{
+		ObjectIds: queryList(c, "objectId"),
+		Orgs:      queryList(c, "org"),
+	}
+	lastId := c.Get("Last-Event-ID")
+	if lastId != "" && !feed.ValidID(lastId) {
+		return problem.BadRequest(problem.CodeInvalidParameter, "Invalid Last-Event-ID")
+	}
+
+	// The stream outlives the handler, so keep the trace and request ID but
+	// not the request's lifetime
+	ctx := context.WithoutCancel(c.UserContext())
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Stop proxies such as nginx from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamFeed(ctx, w, filter, lastId)
+	})
+	return nil
+}
+
+// streamFeed writes the stream until the client goes away or the feed
+// closes the subscription.
+func streamFeed(ctx context.Context, w *bufio.Writer, filter feed.Filter, lastId string) {
+	// Subscribe before reading the backlog so nothing falls in between
+	sub := feed.Subscribe(filter)
+	defer sub.Close()
+	metrics.FeedSubscribers.Inc()
+	defer metrics.FeedSubscribers.Dec()
+
+	fmt.Fprintf(w, "retry: %d\n\n", feedRetryDelay.Milliseconds())
+	if lastId != "" {
+		backlog, err := feed.Since(ctx, lastId)
+		switch {
+		case errors.Is(err, feed.ErrTrimmed):
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+			lastId = ""
+		case err != nil:
+			// Ending the stream makes the client retry with the same id
+			slog.ErrorContext(ctx, "Failed to read the feed", "lastEventId", lastId, "error", err)
+			return
+		}
+		for _, entry := range backlog {
+			if filter.Matches(entry.Event) {
+				if err := writeFeedEntry(w, entry); err != nil {
+					return
+				}
+			}
+			lastId = entry.ID
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case entry, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			// Already sent from the backlog
+			if lastId != "" && feed.CompareIDs(entry.ID, lastId) <= 0 {
+				continue
+			}
+			if err := writeFeedEntry(w, entry); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// A comment keeps proxies from timing out an idle stream, and
+			// is how a client that went away is noticed
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeFeedEntry(w *bufio.Writer, entry feed.Entry) error {
+	data, err := json.Marshal(entry.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", entry.ID, entry.Event.EventType(), data)
+	return err
+}
+
+// queryList collects a query parameter given repeatedly, comma separated,
+// or both.
+func queryList(c *fiber.Ctx, key string) []string {
+	var list []string
+	for _, value := range c.Context().QueryArgs().PeekMulti(key) {
+		for _, item := range strings.Split(string(value), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
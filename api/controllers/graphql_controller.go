@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/middleware"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/trash"
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+)
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL executes a query or mutation against the plan graph. As the
+// GraphQL over HTTP convention has it, errors from resolvers are reported
+// in the body of a 200 response; their extensions carry the problem code
+// and HTTP status the REST endpoint would have answered with.
+func GraphQL(c *fiber.Ctx) error {
+	var req graphqlRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.BadRequest(problem.CodeInvalidJSON, "Invalid JSON format").WithCause(err)
+	}
+	if req.Query == "" {
+		return problem.BadRequest(problem.CodeInvalidParameter, "query is required")
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        c.UserContext(),
+	})
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// graphqlError exposes a problem as a GraphQL error.
+type graphqlError struct {
+	*problem.Problem
+}
+
+func (e graphqlError) Error() string {
+	return e.Detail
+}
+
+func (e graphqlError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code, "status": e.Status}
+	if e.ObjectId != "" {
+		ext["objectId"] = e.ObjectId
+	}
+	if len(e.Errors) > 0 {
+		ext["errors"] = e.Errors
+	}
+	return ext
+}
+
+// resolverError turns whatever a resolver failed with into a graphqlError,
+// logging server errors the way problem.Handler does.
+func resolverError(ctx context.Context, err error) error {
+	var p *problem.Problem
+	if !errors.As(err, &p) {
+		p = problem.Internal("Internal server error", err)
+	}
+	if p.Status >= fiber.StatusInternalServerError {
+		slog.ErrorContext(ctx, "GraphQL resolver failed", "error", p)
+	}
+	return graphqlError{p}
+}
+
+// planNode is the source of a Plan, read together with its ETag so that
+// listing plans takes no lookup per plan.
+type planNode struct {
+	plan models.Plan
+	etag string
+}
+
+func (n planNode) Resolve(p graphql.ResolveParams) (interface{}, error) {
+	if p.Info.FieldName != "etag" {
+		p.Source = n.plan
+		return graphql.DefaultResolveFn(p)
+	}
+	if n.etag == "" {
+		return nil, nil
+	}
+	return n.etag, nil
+}
+
+// loadPlanNodes reads the plans ids names, and their ETags, in one MGET,
+// leaving out those that do not exist. Each plan is returned once.
+func loadPlanNodes(ctx context.Context, ids []string) ([]planNode, error) {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	keys := make([]string, 0, 2*len(ids))
+	for _, id := range ids {
+		if middleware.ValidPlanId(id) {
+			keys = append(keys, id, id+":etag")
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	vals, err := config.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var nodes []planNode
+	// keys holds each plan followed by its ETag
+	for i := 0; i < len(vals); i += 2 {
+		val, ok := vals[i].(string)
+		if !ok {
+			continue
+		}
+		var plan models.Plan
+		if err := json.Unmarshal([]byte(val), &plan); err != nil || plan.ObjectType != "plan" {
+			continue
+		}
+		etag, _ := vals[i+1].(string)
+		nodes = append(nodes, planNode{plan: plan, etag: etag})
+	}
+	return nodes, nil
+}
+
+// loadETags fills in the ETags of nodes in one MGET.
+func loadETags(ctx context.Context, nodes []planNode) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	keys := make([]string, len(nodes))
+	for i, node := range nodes {
+		keys[i] = node.plan.ObjectId + ":etag"
+	}
+	vals, err := config.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return err
+	}
+	for i, val := range vals {
+		nodes[i].etag, _ = val.(string)
+	}
+	return nil
+}
+
+func resolvePlan(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["objectId"].(string)
+	plan, etag, err := loadStoredPlan(p.Context, id)
+	var notFound *problem.Problem
+	if errors.As(err, &notFound) && notFound.Code == problem.CodePlanNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	return planNode{plan: plan, etag: etag}, nil
+}
+
+func resolvePlans(p graphql.ResolveParams) (interface{}, error) {
+	filter, err := newGraphQLFilter(p.Args)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	var ids []string
+	if list, ok := p.Args["objectId"].([]interface{}); ok {
+		for _, id := range list {
+			ids = append(ids, id.(string))
+		}
+	}
+
+	var nodes []planNode
+	keep := func(plan models.Plan, etag string) {
+		if filter.matchesOrg(plan.Org) && filter.matchesField(planObjects(plan)...) {
+			nodes = append(nodes, planNode{plan: plan, etag: etag})
+		}
+	}
+	if ids != nil {
+		// Named plans are read directly rather than found by a scan
+		found, err := loadPlanNodes(p.Context, ids)
+		if err != nil {
+			return nil, resolverError(p.Context, problem.Internal("Failed to retrieve plans", err))
+		}
+		for _, node := range found {
+			keep(node.plan, node.etag)
+		}
+	} else {
+		err = forEachPlan(p.Context, func(plan models.Plan, _ string) error {
+			keep(plan, "")
+			return nil
+		})
+		if err != nil {
+			return nil, resolverError(p.Context, problem.Internal("Failed to retrieve plans", err))
+		}
+	}
+
+	slices.SortFunc(nodes, func(a, b planNode) int { return cmp.Compare(a.plan.ObjectId, b.plan.ObjectId) })
+	nodes = limitResults(nodes, filter.limit)
+	if ids == nil {
+		if err := loadETags(p.Context, nodes); err != nil {
+			return nil, resolverError(p.Context, problem.Internal("Failed to retrieve plans", err))
+		}
+	}
+	if nodes == nil {
+		nodes = []planNode{}
+	}
+	return nodes, nil
+}
+
+func resolveLinkedServices(p graphql.ResolveParams) (interface{}, error) {
+	return resolveObjects(p, func(plan models.Plan, add func(objectId, org string, object interface{})) {
+		for _, lps := range plan.LinkedPlanServices {
+			add(lps.LinkedService.ObjectId, lps.LinkedService.Org, lps.LinkedService)
+		}
+	})
+}
+
+func resolveCostShares(p graphql.ResolveParams) (interface{}, error) {
+	return resolveObjects(p, func(plan models.Plan, add func(objectId, org string, object interface{})) {
+		if plan.PlanCostShares != nil {
+			add(plan.PlanCostShares.ObjectId, plan.PlanCostShares.Org, *plan.PlanCostShares)
+		}
+		for _, lps := range plan.LinkedPlanServices {
+			add(lps.PlanServiceCostShares.ObjectId, lps.PlanServiceCostShares.Org, lps.PlanServiceCostShares)
+		}
+	})
+}
+
+// resolveObjects collects the objects collect finds in every plan, once
+// per objectId, applies the filters and orders them by objectId.
+func resolveObjects(p graphql.ResolveParams, collect func(plan models.Plan, add func(objectId, org string, object interface{}))) (interface{}, error) {
+	filter, err := newGraphQLFilter(p.Args)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	objects := map[string]interface{}{}
+	err = forEachPlan(p.Context, func(plan models.Plan, _ string) error {
+		collect(plan, func(objectId, org string, object interface{}) {
+			if _, seen := objects[objectId]; seen {
+				return
+			}
+			if filter.matchesOrg(org) && filter.matchesField(object) {
+				objects[objectId] = object
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, resolverError(p.Context, problem.Internal("Failed to retrieve plans", err))
+	}
+
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	ids = limitResults(ids, filter.limit)
+	result := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, objects[id])
+	}
+	return result, nil
+}
+
+func resolveCreatePlan(p graphql.ResolveParams) (interface{}, error) {
+	plan, err := decodePlanInput(p.Args["plan"])
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	etag, err := createPlan(p.Context, plan)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	return planNode{plan: plan, etag: etag}, nil
+}
+
+func resolvePatchPlan(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["objectId"].(string)
+	ifMatch, _ := p.Args["ifMatch"].(string)
+	update, err := decodePlanInput(p.Args["patch"])
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	plan, etag, err := patchPlan(p.Context, id, ifMatch, func(plan *models.Plan) error {
+		return mergePlan(plan, update)
+	})
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	return planNode{plan: plan, etag: etag}, nil
+}
+
+func resolveDeletePlan(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["objectId"].(string)
+	ifMatch, _ := p.Args["ifMatch"].(string)
+	if err := deletePlan(p.Context, id, ifMatch); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	return map[string]interface{}{
+		"objectId":   id,
+		"purgeAfter": trash.Retention().String(),
+	}, nil
+}
+
+// decodePlanInput converts a PlanInput argument into a plan. The input
+// type has the JSON field names, so a round trip through JSON does it.
+func decodePlanInput(input interface{}) (models.Plan, error) {
+	var plan models.Plan
+	data, err := json.Marshal(input)
+	if err == nil {
+		err = json.Unmarshal(data, &plan)
+	}
+	if err != nil {
+		return plan, problem.BadRequest(problem.CodeInvalidJSON, "Invalid plan input").WithCause(err)
+	}
+	return plan, nil
+}
+
+// graphqlFilter holds the filter arguments of the list queries.
+type graphqlFilter struct {
+	org   string
+	key   string
+	value string
+	limit int
+}
+
+func newGraphQLFilter(args map[string]interface{}) (graphqlFilter, error) {
+	var f graphqlFilter
+	f.org, _ = args["org"].(string)
+	f.key, _ = args["key"].(string)
+	f.value, _ = args["value"].(string)
+	if (f.key == "") != (f.value == "") {
+		return f, problem.BadRequest(problem.CodeInvalidParameter, "key and value must be given together")
+	}
+	if limit, ok := args["limit"].(int); ok {
+		if limit < 1 {
+			return f, problem.BadRequest(problem.CodeInvalidParameter, "limit must be a positive integer")
+		}
+		f.limit = limit
+	}
+	return f, nil
+}
+
+func (f graphqlFilter) matchesOrg(org string) bool {
+	return f.org == "" || f.org == org
+}
+
+// matchesField reports whether any of objects has the key field set to
+// value. Only strings, numbers and booleans are compared.
+func (f graphqlFilter) matchesField(objects ...interface{}) bool {
+	if f.key == "" {
+		return true
+	}
+	for _, object := range objects {
+		data, err := json.Marshal(object)
+		if err != nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			continue
+		}
+		switch v := fields[f.key].(type) {
+		case string, float64, bool:
+			if fmt.Sprint(v) == f.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// limitResults keeps the first limit items, or all of them when limit is
+// zero.
+func limitResults[T any](items []T, limit int) []T {
+	if limit > 0 && len(items) > limit {
+		return items[:limit]
+	}
+	return items
+}
+
+// planObjects lists a plan and every object in it.
+func planObjects(plan models.Plan) []interface{} {
+	objects := []interface{}{plan}
+	if plan.PlanCostShares != nil {
+		objects = append(objects, plan.PlanCostShares)
+	}
+	for _, lps := range plan.LinkedPlanServices {
+		objects = append(objects, lps, lps.LinkedService, lps.PlanServiceCostShares)
+	}
+	return objects
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+type graphqlResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// graphqlQuery runs query through the GraphQL endpoint.
+func graphqlQuery(t *testing.T, query string, variables map[string]interface{}) graphqlResponse {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: problem.Handler})
+	app.Post("/graphql", GraphQL)
+
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(fiber.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var result graphqlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestGraphQLSelection(t *testing.T) {
+	setupStore(t)
+	ctx := context.Background()
+	etags := map[string]string{}
+	for _, id := range []string{"plan-2", "plan-1", "plan-3"} {
+		etag, err := createPlan(ctx, testPlan(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		etags[id] = etag
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "plan returns only the selected fields",
+			query: `{ plan(objectId: "plan-1") { objectId etag planCostShares { copay } } }`,
+			want:  `{"plan": {"objectId": "plan-1", "etag": ETAG1, "planCostShares": {"copay": 23}}}`,
+		},
+		{
+			name:  "plan that does not exist is null",
+			query: `{ plan(objectId: "plan-9") { objectId } }`,
+			want:  `{"plan": null}`,
+		},
+		{
+			name:  "plans are ordered by objectId",
+			query: `{ plans { objectId etag } }`,
+			want: `{"plans": [
+				{"objectId": "plan-1", "etag": ETAG1},
+				{"objectId": "plan-2", "etag": ETAG2},
+				{"objectId": "plan-3", "etag": ETAG3}
+			]}`,
+		},
+		{
+			name:  "plans by objectId skip missing and repeated ids",
+			query: `{ plans(objectId: ["plan-3", "plan-9", "plan-1", "plan-3"]) { objectId etag linkedPlanServices { linkedService { name } } } }`,
+			want: `{"plans": [
+				{"objectId": "plan-1", "etag": ETAG1, "linkedPlanServices": [{"linkedService": {"name": "Yearly physical"}}]},
+				{"objectId": "plan-3", "etag": ETAG3, "linkedPlanServices": [{"linkedService": {"name": "Yearly physical"}}]}
+			]}`,
+		},
+		{
+			name:  "plans by objectId apply the filters",
+			query: `{ plans(objectId: ["plan-1", "plan-2"], limit: 1) { objectId } }`,
+			want:  `{"plans": [{"objectId": "plan-1"}]}`,
+		},
+		{
+			name:  "plans by objectId that match nothing",
+			query: `{ plans(objectId: ["plan-9"]) { objectId } }`,
+			want:  `{"plans": []}`,
+		},
+	}
+	// ETAGn in want stands for the ETag of plan-n
+	quote := func(id string) string {
+		data, _ := json.Marshal(etags[id])
+		return string(data)
+	}
+	placeholders := strings.NewReplacer("ETAG1", quote("plan-1"), "ETAG2", quote("plan-2"), "ETAG3", quote("plan-3"))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := graphqlQuery(t, tt.query, nil)
+			if len(result.Errors) > 0 {
+				t.Fatalf("errors: %+v", result.Errors)
+			}
+
+			want := placeholders.Replace(tt.want)
+			var wantData map[string]interface{}
+			if err := json.Unmarshal([]byte(want), &wantData); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Data, wantData) {
+				got, _ := json.Marshal(result.Data)
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestGraphQLPatchPlanStaleIfMatch(t *testing.T) {
+	setupStore(t)
+	if _, err := createPlan(context.Background(), testPlan("plan-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	result := graphqlQuery(t, `mutation($ifMatch: String!) {
+		patchPlan(objectId: "plan-1", ifMatch: $ifMatch, patch: {creationDate: "01-01-2024"}) { objectId }
+	}`, map[string]interface{}{"ifMatch": `"stale"`})
+
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %+v, want one", result.Errors)
+	}
+	ext := result.Errors[0].Extensions
+	if ext["code"] != problem.CodePreconditionFailed || ext["status"] != float64(fiber.StatusPreconditionFailed) || ext["objectId"] != "plan-1" {
+		t.Errorf("extensions = %v, want code %q, status 412 and objectId plan-1", ext, problem.CodePreconditionFailed)
+	}
+
+	plan, _, err := loadStoredPlan(context.Background(), "plan-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.CreationDate != "12-12-2017" {
+		t.Errorf("creationDate = %q, want the plan unchanged", plan.CreationDate)
+	}
+}
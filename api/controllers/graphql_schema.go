@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+// The GraphQL schema mirrors the plan JSON: field names, _org included,
+// are the same as in the REST bodies, and the input types accept the same
+// documents as POST and PATCH /plans. Plans also expose their etag.
+var graphqlSchema = newGraphQLSchema()
+
+func newGraphQLSchema() graphql.Schema {
+	costSharesType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "CostShares",
+		Description: "The cost shares of a plan or of one of its services",
+		Fields: graphql.Fields{
+			"objectId":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"objectType": &graphql.Field{Type: graphql.String},
+			"_org":       &graphql.Field{Type: graphql.String},
+			"deductible": &graphql.Field{Type: graphql.Int},
+			"copay":      &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	linkedServiceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "LinkedService",
+		Fields: graphql.Fields{
+			"objectId":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"objectType": &graphql.Field{Type: graphql.String},
+			"_org":       &graphql.Field{Type: graphql.String},
+			"name":       &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	linkedPlanServiceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "LinkedPlanService",
+		Fields: graphql.Fields{
+			"objectId":              &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"objectType":            &graphql.Field{Type: graphql.String},
+			"_org":                  &graphql.Field{Type: graphql.String},
+			"linkedService":         &graphql.Field{Type: linkedServiceType},
+			"planserviceCostShares": &graphql.Field{Type: costSharesType},
+		},
+	})
+
+	planType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Plan",
+		Fields: graphql.Fields{
+			"objectId":           &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"objectType":         &graphql.Field{Type: graphql.String},
+			"_org":               &graphql.Field{Type: graphql.String},
+			"creationDate":       &graphql.Field{Type: graphql.String},
+			"etag":               &graphql.Field{Type: graphql.String, Description: "The value to send as ifMatch"},
+			"planCostShares":     &graphql.Field{Type: costSharesType},
+			"linkedPlanServices": &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(linkedPlanServiceType))},
+		},
+	})
+
+	deleteResultType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DeleteResult",
+		Fields: graphql.Fields{
+			"objectId":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"purgeAfter": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	costSharesInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CostSharesInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"objectId":   &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"objectType": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"_org":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"deductible": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"copay":      &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		},
+	})
+
+	linkedServiceInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "LinkedServiceInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"objectId":   &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"objectType": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"_org":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"name":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	linkedPlanServiceInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "LinkedPlanServiceInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"objectId":              &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"objectType":            &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"_org":                  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"linkedService":         &graphql.InputObjectFieldConfig{Type: linkedServiceInput},
+			"planserviceCostShares": &graphql.InputObjectFieldConfig{Type: costSharesInput},
+		},
+	})
+
+	planInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "PlanInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"objectId":           &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"objectType":         &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"_org":               &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"creationDate":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"planCostShares":     &graphql.InputObjectFieldConfig{Type: costSharesInput},
+			"linkedPlanServices": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(linkedPlanServiceInput))},
+		},
+	})
+
+	// The list queries share the filters of the plan search: a key and
+	// value matched against the fields of any object, and the org
+	filterArgs := func(extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		args := graphql.FieldConfigArgument{
+			"org":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Only objects of this org"},
+			"key":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Field to match, e.g. name or deductible; needs value"},
+			"value": &graphql.ArgumentConfig{Type: graphql.String, Description: "Value the field must equal"},
+			"limit": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Return at most this many results"},
+		}
+		for name, arg := range extra {
+			args[name] = arg
+		}
+		return args
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"plan": &graphql.Field{
+				Type:        planType,
+				Description: "A plan by objectId, or null when it does not exist",
+				Args: graphql.FieldConfigArgument{
+					"objectId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolvePlan,
+			},
+			"plans": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(planType))),
+				Description: "Plans ordered by objectId. key and value match a plan when any object in it matches.",
+				Args: filterArgs(graphql.FieldConfigArgument{
+					"objectId": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.ID)), Description: "Only these plans"},
+				}),
+				Resolve: resolvePlans,
+			},
+			"linkedServices": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(linkedServiceType))),
+				Description: "The linked services of every plan, once each, ordered by objectId",
+				Args:        filterArgs(nil),
+				Resolve:     resolveLinkedServices,
+			},
+			"costShares": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(costSharesType))),
+				Description: "The plan and service cost shares of every plan, once each, ordered by objectId",
+				Args:        filterArgs(nil),
+				Resolve:     resolveCostShares,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createPlan": &graphql.Field{
+				Type:        graphql.NewNonNull(planType),
+				Description: "Same as POST /plans",
+				Args: graphql.FieldConfigArgument{
+					"plan": &graphql.ArgumentConfig{Type: graphql.NewNonNull(planInput)},
+				},
+				Resolve: resolveCreatePlan,
+			},
+			"patchPlan": &graphql.Field{
+				Type:        graphql.NewNonNull(planType),
+				Description: "Same as PATCH /plans/{id}, with ifMatch as the If-Match header",
+				Args: graphql.FieldConfigArgument{
+					"objectId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"ifMatch":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"patch":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(planInput)},
+				},
+				Resolve: resolvePatchPlan,
+			},
+			"deletePlan": &graphql.Field{
+				Type:        graphql.NewNonNull(deleteResultType),
+				Description: "Same as DELETE /plans/{id}, with ifMatch as the optional If-Match header",
+				Args: graphql.FieldConfigArgument{
+					"objectId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"ifMatch":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveDeletePlan,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error())
+	}
+	return schema
+}
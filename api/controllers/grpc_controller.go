@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/feed"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/middleware"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/planspb"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/trash"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// NewGRPCServer builds the gRPC server: PlanService behind the same Google
+// ID token check as the REST API, the standard health service, and
+// reflection for tools such as grpcurl.
+func NewGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.UnaryAuthInterceptor),
+		grpc.ChainStreamInterceptor(middleware.StreamAuthInterceptor),
+	)
+	planspb.RegisterPlanServiceServer(srv, PlanService{})
+	healthpb.RegisterHealthServer(srv, grpchealth.NewServer())
+	reflection.Register(srv)
+	return srv
+}
+
+// PlanService implements planspb.PlanServiceServer on top of the functions
+// the REST handlers use, so both APIs store, validate and publish plans the
+// same way.
+type PlanService struct {
+	planspb.UnimplementedPlanServiceServer
+}
+
+func (PlanService) Create(ctx context.Context, req *planspb.CreatePlanRequest) (*planspb.StoredPlan, error) {
+	plan := planFromProto(req.GetPlan())
+	etag, err := createPlan(ctx, plan)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &planspb.StoredPlan{Plan: planToProto(plan), Etag: etag}, nil
+}
+
+func (PlanService) Get(ctx context.Context, req *planspb.GetPlanRequest) (*planspb.StoredPlan, error) {
+	plan, etag, err := loadStoredPlan(ctx, req.GetObjectId())
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &planspb.StoredPlan{Plan: planToProto(plan), Etag: etag}, nil
+}
+
+func (PlanService) List(req *planspb.ListPlansRequest, stream planspb.PlanService_ListServer) error {
+	ctx := stream.Context()
+	filter := feed.Filter{ObjectIds: req.GetObjectIds(), Orgs: req.GetOrgs()}
+
+	var plans []models.Plan
+	err := forEachPlan(ctx, func(plan models.Plan, _ string) error {
+		if filter.Matches(models.PlanMessage{Plan: plan}) {
+			plans = append(plans, plan)
+		}
+		return nil
+	})
+	if err != nil {
+		return grpcError(ctx, problem.Internal("Failed to retrieve plans", err))
+	}
+
+	slices.SortFunc(plans, func(a, b models.Plan) int { return cmp.Compare(a.ObjectId, b.ObjectId) })
+	for _, plan := range plans {
+		if err := stream.Send(planToProto(plan)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (PlanService) Patch(ctx context.Context, req *planspb.PatchPlanRequest) (*planspb.StoredPlan, error) {
+	if req.GetIfMatch() == "" {
+		return nil, grpcError(ctx, problem.PreconditionRequired("if_match is required"))
+	}
+	update := planFromProto(req.GetPlan())
+	merge := func(plan *models.Plan) error { return mergePlan(plan, update) }
+	if paths := req.GetUpdateMask().GetPaths(); len(paths) > 0 {
+		if !req.GetUpdateMask().IsValid(&planspb.Plan{}) {
+			return nil, grpcError(ctx, problem.BadRequest(problem.CodeInvalidParameter, "update_mask names a field Plan does not have"))
+		}
+		merge = func(plan *models.Plan) error { return applyMask(plan, update, paths) }
+	}
+
+	plan, etag, err := patchPlan(ctx, req.GetObjectId(), req.GetIfMatch(), merge)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &planspb.StoredPlan{Plan: planToProto(plan), Etag: etag}, nil
+}
+
+func (PlanService) Delete(ctx context.Context, req *planspb.DeletePlanRequest) (*planspb.DeletePlanResponse, error) {
+	if err := deletePlan(ctx, req.GetObjectId(), req.GetIfMatch()); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &planspb.DeletePlanResponse{
+		ObjectId:   req.GetObjectId(),
+		PurgeAfter: durationpb.New(trash.Retention()),
+	}, nil
+}
+
+// Watch is StreamPlanEvents for gRPC. The stream ends with UNAVAILABLE when
+// the server shuts down; the client should watch again from the last id it
+// got.
+func (PlanService) Watch(req *planspb.WatchPlansRequest, stream planspb.PlanService_WatchServer) error {
+	ctx := stream.Context()
+	filter := feed.Filter{ObjectIds: req.GetObjectIds(), Orgs: req.GetOrgs()}
+	lastId := req.GetLastEventId()
+	if lastId != "" && !feed.ValidID(lastId) {
+		return grpcError(ctx, problem.BadRequest(problem.CodeInvalidParameter, "Invalid last_event_id"))
+	}
+
+	// Subscribe before reading the backlog so nothing falls in between
+	sub := feed.Subscribe(filter)
+	defer sub.Close()
+	metrics.FeedSubscribers.Inc()
+	defer metrics.FeedSubscribers.Dec()
+
+	if lastId != "" {
+		backlog, err := feed.Since(ctx, lastId)
+		if errors.Is(err, feed.ErrTrimmed) {
+			return status.Error(codes.OutOfRange, "last_event_id is no longer in the feed")
+		} else if err != nil {
+			return grpcError(ctx, problem.Internal("Failed to read the feed", err))
+		}
+		for _, entry := range backlog {
+			if filter.Matches(entry.Event) {
+				if err := stream.Send(planEventToProto(entry)); err != nil {
+					return err
+				}
+			}
+			lastId = entry.ID
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case entry, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.Unavailable, "Feed closed, watch again from the last event")
+			}
+			// Already sent from the backlog
+			if lastId != "" && feed.CompareIDs(entry.ID, lastId) <= 0 {
+				continue
+			}
+			if err := stream.Send(planEventToProto(entry)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// applyMask replaces the fields of plan named by paths with those of
+// update. Nested paths are only allowed where replacing one field keeps the
+// objectIds intact.
+func applyMask(plan *models.Plan, update models.Plan, paths []string) error {
+	costShares := func() (*models.PlanCostShares, error) {
+		if plan.PlanCostShares == nil {
+			return nil, problem.Validation(problem.FieldError{Field: "planCostShares", Message: "Plan has no PlanCostShares to update"})
+		}
+		if update.PlanCostShares == nil {
+			update.PlanCostShares = &models.PlanCostShares{}
+		}
+		return plan.PlanCostShares, nil
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "object_type":
+			plan.ObjectType = update.ObjectType
+		case "org":
+			plan.Org = update.Org
+		case "creation_date":
+			plan.CreationDate = update.CreationDate
+		case "plan_cost_shares":
+			plan.PlanCostShares = update.PlanCostShares
+		case "linked_plan_services":
+			plan.LinkedPlanServices = update.LinkedPlanServices
+		case "plan_cost_shares.deductible", "plan_cost_shares.copay", "plan_cost_shares.object_type", "plan_cost_shares.org":
+			target, err := costShares()
+			if err != nil {
+				return err
+			}
+			switch path {
+			case "plan_cost_shares.deductible":
+				target.Deductible = update.PlanCostShares.Deductible
+			case "plan_cost_shares.copay":
+				target.Copay = update.PlanCostShares.Copay
+			case "plan_cost_shares.object_type":
+				target.ObjectType = update.PlanCostShares.ObjectType
+			case "plan_cost_shares.org":
+				target.Org = update.PlanCostShares.Org
+			}
+		default:
+			return problem.Validation(problem.FieldError{Field: path, Message: "Field cannot be updated through update_mask"})
+		}
+	}
+
+	if errs := validatePlan(*plan); len(errs) > 0 {
+		return problem.Validation(errs...).WithObject(plan.ObjectId)
+	}
+	return nil
+}
+
+// grpcError is problem.Handler for gRPC: the status code matching the REST
+// status, with the problem code as ErrorInfo reason and invalid fields as
+// BadRequest field violations.
+func grpcError(ctx context.Context, err error) error {
+	var p *problem.Problem
+	if !errors.As(err, &p) {
+		p = problem.Internal("Internal server error", err)
+	}
+	if p.Status >= fiber.StatusInternalServerError {
+		slog.ErrorContext(ctx, "gRPC call failed", "error", p)
+	}
+
+	st := status.New(grpcCode(p.Status), p.Detail)
+	info := &errdetails.ErrorInfo{Reason: p.Code, Domain: "plans"}
+	if p.ObjectId != "" {
+		info.Metadata = map[string]string{"objectId": p.ObjectId}
+	}
+	details := []protoadapt.MessageV1{info}
+	if len(p.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, fieldErr := range p.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fieldErr.Field,
+				Description: fieldErr.Message,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case fiber.StatusBadRequest:
+		return codes.InvalidArgument
+	case fiber.StatusUnauthorized:
+		return codes.Unauthenticated
+	case fiber.StatusForbidden:
+		return codes.PermissionDenied
+	case fiber.StatusNotFound:
+		return codes.NotFound
+	case fiber.StatusConflict:
+		return codes.AlreadyExists
+	case fiber.StatusPreconditionFailed, fiber.StatusPreconditionRequired:
+		return codes.FailedPrecondition
+	case fiber.StatusRequestEntityTooLarge:
+		return codes.ResourceExhausted
+	}
+	if httpStatus >= fiber.StatusInternalServerError {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
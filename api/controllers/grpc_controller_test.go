@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestApplyMask(t *testing.T) {
+	noCostShares := func(plan *models.Plan) { plan.PlanCostShares = nil }
+
+	tests := []struct {
+		name      string
+		plan      func(plan *models.Plan)
+		update    models.Plan
+		paths     []string
+		want      func(plan *models.Plan)
+		wantField string
+	}{
+		{
+			name:  "no paths change nothing",
+			paths: nil,
+			want:  func(*models.Plan) {},
+		},
+		{
+			name:   "top level fields",
+			update: models.Plan{Org: "example.org", CreationDate: "01-01-2024"},
+			paths:  []string{"org", "creation_date"},
+			want: func(plan *models.Plan) {
+				plan.Org = "example.org"
+				plan.CreationDate = "01-01-2024"
+			},
+		},
+		{
+			name:   "nested path replaces one cost shares field",
+			update: models.Plan{PlanCostShares: &models.PlanCostShares{Copay: 50, Deductible: 1}},
+			paths:  []string{"plan_cost_shares.copay"},
+			want:   func(plan *models.Plan) { plan.PlanCostShares.Copay = 50 },
+		},
+		{
+			name:   "several nested paths",
+			update: models.Plan{PlanCostShares: &models.PlanCostShares{Deductible: 500, Org: "example.org", ObjectType: "costshare"}},
+			paths:  []string{"plan_cost_shares.deductible", "plan_cost_shares.org", "plan_cost_shares.object_type"},
+			want: func(plan *models.Plan) {
+				plan.PlanCostShares.Deductible = 500
+				plan.PlanCostShares.Org = "example.org"
+				plan.PlanCostShares.ObjectType = "costshare"
+			},
+		},
+		{
+			name:  "nested path without cost shares in the update clears the field",
+			paths: []string{"plan_cost_shares.deductible"},
+			want:  func(plan *models.Plan) { plan.PlanCostShares.Deductible = 0 },
+		},
+		{
+			name:      "nested path on a plan without cost shares",
+			plan:      noCostShares,
+			update:    models.Plan{PlanCostShares: &models.PlanCostShares{Copay: 50}},
+			paths:     []string{"plan_cost_shares.copay"},
+			wantField: "planCostShares",
+		},
+		{
+			name:   "whole cost shares on a plan without them",
+			plan:   noCostShares,
+			update: models.Plan{PlanCostShares: &models.PlanCostShares{ObjectId: "new-costs", Copay: 50}},
+			paths:  []string{"plan_cost_shares"},
+			want: func(plan *models.Plan) {
+				plan.PlanCostShares = &models.PlanCostShares{ObjectId: "new-costs", Copay: 50}
+			},
+		},
+		{
+			name:      "whole cost shares removed",
+			paths:     []string{"plan_cost_shares"},
+			wantField: "planCostShares.objectId",
+		},
+		{
+			name:      "nested path that would change an objectId",
+			update:    models.Plan{PlanCostShares: &models.PlanCostShares{ObjectId: "other"}},
+			paths:     []string{"plan_cost_shares.object_id"},
+			wantField: "plan_cost_shares.object_id",
+		},
+		{
+			name:      "unknown path",
+			paths:     []string{"premium"},
+			wantField: "premium",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := testPlan("plan-1")
+			if tt.plan != nil {
+				tt.plan(&plan)
+			}
+
+			err := applyMask(&plan, tt.update, tt.paths)
+			if tt.wantField != "" {
+				var p *problem.Problem
+				if !errors.As(err, &p) || len(p.Errors) == 0 || p.Errors[0].Field != tt.wantField {
+					t.Fatalf("applyMask = %v, want a validation error on %s", err, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyMask: %v", err)
+			}
+			want := testPlan("plan-1")
+			if tt.plan != nil {
+				tt.plan(&want)
+			}
+			tt.want(&want)
+			if !reflect.DeepEqual(plan, want) {
+				t.Errorf("plan = %+v, want %+v", plan, want)
+			}
+		})
+	}
+}
+
+func TestGRPCCode(t *testing.T) {
+	tests := []struct {
+		status int
+		want   codes.Code
+	}{
+		{fiber.StatusBadRequest, codes.InvalidArgument},
+		{fiber.StatusUnauthorized, codes.Unauthenticated},
+		{fiber.StatusForbidden, codes.PermissionDenied},
+		{fiber.StatusNotFound, codes.NotFound},
+		{fiber.StatusConflict, codes.AlreadyExists},
+		{fiber.StatusPreconditionFailed, codes.FailedPrecondition},
+		{fiber.StatusPreconditionRequired, codes.FailedPrecondition},
+		{fiber.StatusRequestEntityTooLarge, codes.ResourceExhausted},
+		{fiber.StatusInternalServerError, codes.Internal},
+		{fiber.StatusServiceUnavailable, codes.Internal},
+		{fiber.StatusTeapot, codes.Unknown},
+	}
+	for _, tt := range tests {
+		if got := grpcCode(tt.status); got != tt.want {
+			t.Errorf("grpcCode(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   codes.Code
+		wantReason string
+		wantObject string
+		wantFields []string
+	}{
+		{
+			name:       "problem with an object",
+			err:        problem.PreconditionFailed("Plan has been modified").WithObject("plan-1"),
+			wantCode:   codes.FailedPrecondition,
+			wantReason: problem.CodePreconditionFailed,
+			wantObject: "plan-1",
+		},
+		{
+			name: "validation problem",
+			err: problem.Validation(
+				problem.FieldError{Field: "objectId", Message: "ObjectId is required"},
+				problem.FieldError{Field: "linkedPlanServices", Message: "At least one LinkedPlanService is required"},
+			),
+			wantCode:   codes.InvalidArgument,
+			wantReason: problem.CodeValidationFailed,
+			wantFields: []string{"objectId", "linkedPlanServices"},
+		},
+		{
+			name:       "wrapped problem",
+			err:        errors.Join(errors.New("context"), problem.NotFound(problem.CodePlanNotFound, "Plan not found")),
+			wantCode:   codes.NotFound,
+			wantReason: problem.CodePlanNotFound,
+		},
+		{
+			name:       "any other error",
+			err:        errors.New("connection refused"),
+			wantCode:   codes.Internal,
+			wantReason: problem.CodeInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(grpcError(context.Background(), tt.err))
+			if st.Code() != tt.wantCode {
+				t.Errorf("code = %v, want %v", st.Code(), tt.wantCode)
+			}
+
+			var info *errdetails.ErrorInfo
+			var fields []string
+			for _, detail := range st.Details() {
+				switch d := detail.(type) {
+				case *errdetails.ErrorInfo:
+					info = d
+				case *errdetails.BadRequest:
+					for _, v := range d.GetFieldViolations() {
+						fields = append(fields, v.GetField())
+					}
+				}
+			}
+			if info == nil {
+				t.Fatal("no ErrorInfo detail")
+			}
+			if info.GetReason() != tt.wantReason || info.GetMetadata()["objectId"] != tt.wantObject {
+				t.Errorf("ErrorInfo = %v, want reason %s and objectId %q", info, tt.wantReason, tt.wantObject)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("field violations = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
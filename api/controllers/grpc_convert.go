@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"github.com/dumbresi/Healthcare-Plan-Management/api/feed"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/planspb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The proto messages have the fields of the plan JSON, so converting is a
+// field by field copy. Unset messages become zero values, which the shared
+// validation then reports like a missing JSON field.
+
+func planFromProto(p *planspb.Plan) models.Plan {
+	plan := models.Plan{
+		ObjectId:     p.GetObjectId(),
+		ObjectType:   p.GetObjectType(),
+		Org:          p.GetOrg(),
+		CreationDate: p.GetCreationDate(),
+	}
+	if cs := p.GetPlanCostShares(); cs != nil {
+		plan.PlanCostShares = &models.PlanCostShares{
+			ObjectId:   cs.GetObjectId(),
+			ObjectType: cs.GetObjectType(),
+			Org:        cs.GetOrg(),
+			Deductible: int(cs.GetDeductible()),
+			Copay:      int(cs.GetCopay()),
+		}
+	}
+	for _, lps := range p.GetLinkedPlanServices() {
+		ls, cs := lps.GetLinkedService(), lps.GetPlanserviceCostShares()
+		plan.LinkedPlanServices = append(plan.LinkedPlanServices, models.LinkedPlanService{
+			ObjectId:   lps.GetObjectId(),
+			ObjectType: lps.GetObjectType(),
+			Org:        lps.GetOrg(),
+			LinkedService: models.LinkedService{
+				ObjectId:   ls.GetObjectId(),
+				ObjectType: ls.GetObjectType(),
+				Org:        ls.GetOrg(),
+				Name:       ls.GetName(),
+			},
+			PlanServiceCostShares: models.PlanServiceCostShares{
+				ObjectId:   cs.GetObjectId(),
+				ObjectType: cs.GetObjectType(),
+				Org:        cs.GetOrg(),
+				Deductible: int(cs.GetDeductible()),
+				Copay:      int(cs.GetCopay()),
+			},
+		})
+	}
+	return plan
+}
+
+func planToProto(plan models.Plan) *planspb.Plan {
+	p := &planspb.Plan{
+		ObjectId:     plan.ObjectId,
+		ObjectType:   plan.ObjectType,
+		Org:          plan.Org,
+		CreationDate: plan.CreationDate,
+	}
+	if cs := plan.PlanCostShares; cs != nil {
+		p.PlanCostShares = &planspb.PlanCostShares{
+			ObjectId:   cs.ObjectId,
+			ObjectType: cs.ObjectType,
+			Org:        cs.Org,
+			Deductible: int64(cs.Deductible),
+			Copay:      int64(cs.Copay),
+		}
+	}
+	for _, lps := range plan.LinkedPlanServices {
+		p.LinkedPlanServices = append(p.LinkedPlanServices, &planspb.LinkedPlanService{
+			ObjectId:   lps.ObjectId,
+			ObjectType: lps.ObjectType,
+			Org:        lps.Org,
+			LinkedService: &planspb.LinkedService{
+				ObjectId:   lps.LinkedService.ObjectId,
+				ObjectType: lps.LinkedService.ObjectType,
+				Org:        lps.LinkedService.Org,
+				Name:       lps.LinkedService.Name,
+			},
+			PlanserviceCostShares: &planspb.PlanServiceCostShares{
+				ObjectId:   lps.PlanServiceCostShares.ObjectId,
+				ObjectType: lps.PlanServiceCostShares.ObjectType,
+				Org:        lps.PlanServiceCostShares.Org,
+				Deductible: int64(lps.PlanServiceCostShares.Deductible),
+				Copay:      int64(lps.PlanServiceCostShares.Copay),
+			},
+		})
+	}
+	return p
+}
+
+func planEventToProto(entry feed.Entry) *planspb.PlanEvent {
+	event := entry.Event
+	return &planspb.PlanEvent{
+		Id:         entry.ID,
+		Type:       event.EventType(),
+		EventId:    event.EventId,
+		Sequence:   event.Sequence,
+		OccurredAt: timestamppb.New(event.OccurredAt),
+		Actor:      event.Actor,
+		Etag:       event.ETag,
+		Plan:       planToProto(event.Plan),
+	}
+}
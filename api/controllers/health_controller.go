@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/broker"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/elastic"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/feed"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/health"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/indexer"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/rabbitmq"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	esOnce      sync.Once
+	esClient    *elasticsearch.Client
+	esTransport = http.DefaultTransport.(*http.Transport).Clone()
+)
+
+// searchClient builds the Elasticsearch client the readiness probe uses on
+// first call.
+func searchClient() *elasticsearch.Client {
+	esOnce.Do(func() {
+		client, err := elastic.NewElasticFactory().NewClient(elasticsearch.Config{
+			Addresses: []string{"http://localhost:9200"},
+			Transport: esTransport,
+		})
+		if err == nil {
+			esClient = client.ES
+		}
+	})
+	return esClient
+}
+
+// CloseSearchClient drops the Elasticsearch client's idle connections on
+// shutdown.
+func CloseSearchClient() {
+	esTransport.CloseIdleConnections()
+}
+
+// Healthz is the liveness probe: the process is up and serving requests.
+func Healthz(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": health.StatusUp})
+}
+
+// Readyz is the readiness probe: every dependency a request may touch is
+// reachable. With the in-process event bus the API indexes plans itself,
+// so the plans index has to exist too.
+func Readyz(c *fiber.Ctx) error {
+	checks := map[string]health.Check{
+		"redis": health.Redis(config.RedisClient),
+	}
+	publisher := config.Events
+	if p, ok := publisher.(feed.Publisher); ok {
+		publisher = p.EventPublisher
+	}
+	switch p := publisher.(type) {
+	case *rabbitmq.Factory:
+		checks["rabbitmq"] = health.RabbitMQ(p)
+		checks["elasticsearch"] = health.Elasticsearch(searchClient(), "")
+	case *broker.Memory:
+		checks["elasticsearch"] = health.Elasticsearch(searchClient(), indexer.Index)
+	}
+	report := health.Run(c.UserContext(), checks)
+
+	status := fiber.StatusOK
+	if !report.Ready() {
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(report)
+}
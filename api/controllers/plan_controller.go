@@ -4,66 +4,97 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"strings"
 
 	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/events"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/middleware"
 	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
-	"github.com/dumbresi/Healthcare-Plan-Management/api/rabbitmq"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/trash"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/versions"
 	"github.com/redis/go-redis/v9"
 
-	// "github.com/dumbresi/Healthcare-Plan-Management/api/utils"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
-var ctx = context.Background()
-
 func GetAllPlans(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	var allPlans []models.Plan
+
+	err := forEachPlan(ctx, func(plan models.Plan, _ string) error {
+		allPlans = append(allPlans, plan)
+		return nil
+	})
+	if err != nil {
+		return problem.Internal("Failed to retrieve plans", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(allPlans)
+}
+
+// forEachPlan walks every live plan in Redis, passing both the decoded plan
+// and the stored JSON to fn. Iteration stops at the first error from fn.
+func forEachPlan(ctx context.Context, fn func(plan models.Plan, raw string) error) error {
 	// Use Redis SCAN to iterate through keys
 	var cursor uint64
-	var allPlans []models.Plan
 
-	// We'll collect all keys first, then filter out the etag keys
 	for {
-		// Scan with pattern match to avoid etag keys
 		keys, nextCursor, err := config.RedisClient.Scan(ctx, cursor, "*", 100).Result()
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve plans"})
+			return err
 		}
 
-		// Process each key
+		// Skip etag keys, deleted plans and other bookkeeping keys
+		planKeys := keys[:0]
 		for _, key := range keys {
-			// Skip etag keys
-			if len(key) > 5 && key[len(key)-5:] == ":etag" {
+			if strings.HasSuffix(key, ":etag") || strings.HasSuffix(key, events.SequenceSuffix) ||
+				strings.HasPrefix(key, trash.Prefix) {
 				continue
 			}
+			planKeys = append(planKeys, key)
+		}
 
-			// Get the plan data
-			val, err := config.RedisClient.Get(ctx, key).Result()
+		// MGET returns nil for anything that is not a string value, so
+		// lists and streams sharing the keyspace drop out here
+		if len(planKeys) > 0 {
+			vals, err := config.RedisClient.MGet(ctx, planKeys...).Result()
 			if err != nil {
-				continue // Skip if there's an error getting this plan
+				return err
 			}
-
-			var plan models.Plan
-			if err := json.Unmarshal([]byte(val), &plan); err != nil {
-				continue // Skip if it's not a valid plan
-			}
-
-			// Only include documents that are actually plans (they have an ObjectType)
-			if plan.ObjectType == "plan" {
-				allPlans = append(allPlans, plan)
+			for _, v := range vals {
+				val, ok := v.(string)
+				if !ok {
+					continue
+				}
+
+				var plan models.Plan
+				if err := json.Unmarshal([]byte(val), &plan); err != nil {
+					continue // Skip if it's not a valid plan
+				}
+
+				// Only include documents that are actually plans (they have an ObjectType)
+				if plan.ObjectType != "plan" {
+					continue
+				}
+				if err := fn(plan, val); err != nil {
+					return err
+				}
 			}
 		}
 
 		// Break if we've completed the scan
 		cursor = nextCursor
 		if cursor == 0 {
-			break
+			return nil
 		}
 	}
-
-	return c.Status(fiber.StatusOK).JSON(allPlans)
 }
 
 func CreatePlan(c *fiber.Ctx) error {
@@ -71,302 +102,404 @@ func CreatePlan(c *fiber.Ctx) error {
 
 	// Step 1: Parse JSON from request body
 	if err := c.BodyParser(&plan); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid JSON format",
-			"details": err.Error(),
-		})
+		return problem.BadRequest(problem.CodeInvalidJSON, "Invalid JSON format").WithCause(err)
 	}
 
-	// Step 2: Basic Validation
-	if plan.ObjectId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Validation failed",
-			"field":   "objectId",
-			"message": "ObjectId is required",
-		})
-	}
-	if plan.PlanCostShares == nil || plan.PlanCostShares.ObjectId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Validation failed",
-			"field":   "planCostShares.objectId",
-			"message": "PlanCostShares and its ObjectId are required",
-		})
-	}
-	if len(plan.LinkedPlanServices) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Validation failed",
-			"field":   "linkedPlanServices",
-			"message": "At least one LinkedPlanService is required",
-		})
-	}
-	for i, service := range plan.LinkedPlanServices {
-		if service.ObjectId == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation failed",
-				"field":   fmt.Sprintf("linkedPlanServices[%d].objectId", i),
-				"message": "LinkedPlanService ObjectId is required",
-			})
-		}
-		if service.LinkedService.ObjectId == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation failed",
-				"field":   fmt.Sprintf("linkedPlanServices[%d].linkedService.objectId", i),
-				"message": "LinkedService ObjectId is required",
-			})
-		}
-		if service.PlanServiceCostShares.ObjectId == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation failed",
-				"field":   fmt.Sprintf("linkedPlanServices[%d].planserviceCostShares.objectId", i),
-				"message": "PlanServiceCostShares ObjectId is required",
-			})
-		}
+	etag, err := createPlan(c.UserContext(), plan)
+	var p *problem.Problem
+	if errors.As(err, &p) && p.Code == problem.CodePlanExists && c.Get("If-None-Match") == "*" {
+		// If-None-Match: * asks for a precondition failure rather than a conflict
+		return problem.PreconditionFailed("Plan already exists").WithObject(plan.ObjectId)
+	} else if err != nil {
+		return err
 	}
 
-	// Step 3: Check if plan already exists
-	exists, err := config.RedisClient.Exists(ctx, plan.ObjectId).Result()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to check plan existence",
-			"details": err.Error(),
-		})
-	}
-	if exists == 1 {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":    "Plan already exists",
-			"objectId": plan.ObjectId,
-		})
+	// Step 6: Set ETag in response header
+	c.Set("ETag", etag)
+
+	// Step 7: Respond success
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Plan created successfully",
+		"objectId": plan.ObjectId,
+	})
+}
+
+// createPlan validates and stores a new plan, then records and publishes
+// the write. It backs POST /plans, the createPlan mutation and the gRPC
+// Create, and returns the plan's ETag.
+func createPlan(ctx context.Context, plan models.Plan) (string, error) {
+	// Step 2: Basic Validation
+	if errs := validatePlan(plan); len(errs) > 0 {
+		return "", problem.Validation(errs...).WithObject(plan.ObjectId)
 	}
 
-	// Step 4: Marshal full plan and subcomponents with error debug logs
+	// Step 3: Marshal full plan and subcomponents with error debug logs
 	planJSON, err := json.Marshal(plan)
 	if err != nil {
-		log.Printf("Failed to marshal full plan: %v", err)
+		slog.WarnContext(ctx, "Failed to marshal full plan", "objectId", plan.ObjectId, "error", err)
 
 		if plan.PlanCostShares != nil {
 			if _, err2 := json.Marshal(plan.PlanCostShares); err2 != nil {
-				log.Printf("Failed to marshal PlanCostShares: %v", err2)
+				slog.WarnContext(ctx, "Failed to marshal PlanCostShares", "error", err2)
 			}
 		}
 
 		for i, lps := range plan.LinkedPlanServices {
 			if _, err := json.Marshal(lps); err != nil {
-				log.Printf("Failed to marshal LinkedPlanService[%d]: %v", i, err)
+				slog.WarnContext(ctx, "Failed to marshal LinkedPlanService", "index", i, "error", err)
 			}
 			if _, err := json.Marshal(lps.LinkedService); err != nil {
-				log.Printf("Failed to marshal LinkedService[%d]: %v", i, err)
+				slog.WarnContext(ctx, "Failed to marshal LinkedService", "index", i, "error", err)
 			}
 			if _, err := json.Marshal(lps.PlanServiceCostShares); err != nil {
-				log.Printf("Failed to marshal PlanServiceCostShares[%d]: %v", i, err)
+				slog.WarnContext(ctx, "Failed to marshal PlanServiceCostShares", "index", i, "error", err)
 			}
 		}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Failed to marshal plan object",
-			"details": err.Error(),
-		})
+		return "", problem.BadRequest(problem.CodeInvalidJSON, "Failed to marshal plan object").WithCause(err)
 	}
 
-	// Step 5: Generate ETag from hash
+	// Step 4: Generate ETag from hash
 	etag := fmt.Sprintf("\"%x\"", sha256.Sum256(planJSON))
 
-	// Step 6: Store plan and ETag in Redis
-	if err := config.RedisClient.Set(ctx, plan.ObjectId, planJSON, 0).Err(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to store plan in Redis"})
-	}
-	if err := config.RedisClient.Set(ctx, plan.ObjectId+":etag", etag, 0).Err(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to store ETag"})
+	// Step 5: Store plan, ETag and first version, but only if the plan does
+	// not exist yet. WATCH makes a concurrent create of the same id abort
+	// this transaction instead of overwriting it.
+	var seq *redis.IntCmd
+	err = config.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, plan.ObjectId).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 1 {
+			return errPlanExists
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, plan.ObjectId, planJSON, 0)
+			pipe.Set(ctx, plan.ObjectId+":etag", etag, 0)
+			seq = events.Next(ctx, pipe, plan.ObjectId)
+			if err := versions.Append(ctx, pipe, plan.ObjectId, etag, currentAuthor(ctx), planJSON); err != nil {
+				return err
+			}
+			return queueAudit(ctx, pipe, "create", plan.ObjectId, "", etag, nil, planJSON)
+		})
+		return err
+	}, plan.ObjectId)
+	if errors.Is(err, errPlanExists) || errors.Is(err, redis.TxFailedErr) {
+		return "", problem.Conflict(problem.CodePlanExists, "Plan already exists").WithObject(plan.ObjectId)
+	} else if err != nil {
+		return "", problem.Internal("Failed to store plan in Redis", err)
 	}
 
-	// Step 7: Set ETag in response header
-	c.Set("ETag", etag)
-
-	msg := models.PlanMessage{
-		Operation: "create",
-		Plan:      plan,
-	}
-	rmq := &rabbitmq.Factory{}
-	if err := rmq.PublishMessage("plans_queue", msg); err != nil {
-	log.Printf("Failed to publish RabbitMQ message: %v", err)
-	// Don't fail the request, but log it (or return 202 Accepted if you want async behavior)
+	msg := events.New("create", plan, etag, currentAuthor(ctx), seq.Val())
+	if err := config.Events.Publish(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish create message", "objectId", plan.ObjectId, "error", err)
+		// Don't fail the request, but log it (or return 202 Accepted if you want async behavior)
 	}
 
-	// Step 8: Respond success
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message":  "Plan created successfully",
-		"objectId": plan.ObjectId,
-	})
+	return etag, nil
 }
 
-
 func GetPlan(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id := c.Params("id")
 
+	shape, err := planShape(c)
+	if err != nil {
+		return err
+	}
+
+	// Point-in-time reads are served from the version history
+	if asOf := c.Query("asOf"); asOf != "" {
+		return getPlanAsOf(c, id, asOf, shape)
+	}
+
 	// Get the stored ETag
 	storedETag, err := config.RedisClient.Get(ctx, id+":etag").Result()
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
+		return planNotFound(id)
 	}
 
 	// Check If-None-Match header for conditional read
-	if ifNoneMatch := c.Get("If-None-Match"); ifNoneMatch != "" && ifNoneMatch == storedETag {
-		return c.SendStatus(fiber.StatusNotModified)
+	if ifNoneMatch := c.Get("If-None-Match"); ifNoneMatch != "" {
+		if ifNoneMatch == storedETag {
+			metrics.ConditionalReads.WithLabelValues("hit").Inc()
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		metrics.ConditionalReads.WithLabelValues("miss").Inc()
 	}
 
 	val, err := config.RedisClient.Get(ctx, id).Result()
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
+		return planNotFound(id)
 	}
 
 	var plan models.Plan
 	json.Unmarshal([]byte(val), &plan)
 
-	// Set ETag in response header
-	c.Set("ETag", storedETag)
-	return c.Status(fiber.StatusOK).JSON(plan)
+	return sendPlan(c, plan, storedETag, shape)
 }
 
-func DeletePlan(c *fiber.Ctx) error {
-    id := c.Params("id")
-
-    // Check if plan exists and get the plan data
-    val, err := config.RedisClient.Get(ctx, id).Result()
-    if err == redis.Nil {
-        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
-    } else if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to fetch plan",
-            "details": err.Error(),
-        })
-    }
-
-    // Unmarshal the plan to get child object IDs
-    var plan models.Plan
-    if err := json.Unmarshal([]byte(val), &plan); err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to unmarshal plan data",
-            "details": err.Error(),
-        })
-    }
-
-    // Collect all keys to delete
-    keysToDelete := []string{
-        id,                // Main plan
-        id + ":etag",     // Plan's ETag
-    }
-
-    // Add PlanCostShares keys
-    if plan.PlanCostShares != nil {
-        keysToDelete = append(keysToDelete, 
-            plan.PlanCostShares.ObjectId,
-            plan.PlanCostShares.ObjectId + ":etag",
-        )
-    }
-
-    // Add LinkedPlanServices and their child objects
-    for _, service := range plan.LinkedPlanServices {
-        // Add LinkedPlanService keys
-        keysToDelete = append(keysToDelete,
-            service.ObjectId,
-            service.ObjectId + ":etag",
-        )
-
-        // Add LinkedService keys
-        keysToDelete = append(keysToDelete,
-            service.LinkedService.ObjectId,
-            service.LinkedService.ObjectId + ":etag",
-        )
-
-        // Add PlanServiceCostShares keys
-        keysToDelete = append(keysToDelete,
-            service.PlanServiceCostShares.ObjectId,
-            service.PlanServiceCostShares.ObjectId + ":etag",
-        )
-    }
-
-    // Use Redis Pipeline to delete all keys atomically
-    pipe := config.RedisClient.Pipeline()
-    for _, key := range keysToDelete {
-        pipe.Del(ctx, key)
-    }
-
-    // Execute the pipeline
-    if _, err := pipe.Exec(ctx); err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to delete plan and its components",
-            "details": err.Error(),
-        })
-    }
-
-    // Publish delete message to RabbitMQ
-    msg := models.PlanMessage{
-        Operation: "delete",
-        Plan:      plan,
-    }
-    rmq := &rabbitmq.Factory{}
-    if err := rmq.PublishMessage("plans_queue", msg); err != nil {
-        log.Printf("Failed to publish delete message: %v", err)
-    }
-
-    return c.Status(fiber.StatusOK).JSON(fiber.Map{
-        "message": "Plan and all related components deleted successfully",
-        "deletedKeys": keysToDelete,
-    })
+// planShape reads ?fields, ?expand and ?depth. ?expand alone inlines only
+// the children it names; without any of them the whole plan is returned.
+func planShape(c *fiber.Ctx) (*utils.JSONShape, error) {
+	fields, expand, depth := queryList(c, "fields"), queryList(c, "expand"), c.Query("depth")
+	if len(fields) == 0 && len(expand) == 0 && depth == "" {
+		return nil, nil
+	}
+
+	shape := &utils.JSONShape{Fields: fields, Expand: expand, Depth: -1}
+	if len(expand) > 0 {
+		shape.Depth = 0
+	}
+	if depth != "" {
+		n, err := strconv.Atoi(depth)
+		if err != nil || n < 0 {
+			return nil, problem.BadRequest(problem.CodeInvalidParameter, "depth must be a non-negative integer")
+		}
+		shape.Depth = n
+	}
+	return shape, nil
 }
 
-func PatchPlan(c *fiber.Ctx) error {
+// sendPlan writes plan in the requested shape. The ETag is always that of
+// the full plan, so If-None-Match and If-Match work whatever was selected.
+func sendPlan(c *fiber.Ctx, plan models.Plan, etag string, shape *utils.JSONShape) error {
+	if shape == nil {
+		c.Set("ETag", etag)
+		return c.Status(fiber.StatusOK).JSON(plan)
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return problem.Internal("Failed to encode plan", err)
+	}
+	shaped, err := shape.Apply(data)
+	if err != nil {
+		return problem.BadRequest(problem.CodeInvalidParameter, err.Error())
+	}
+	c.Set("ETag", etag)
+	return c.Status(fiber.StatusOK).JSON(shaped)
+}
+
+// loadStoredPlan reads a plan and its ETag for the reads that do not go
+// through GetPlan, such as GraphQL, gRPC and the plan diff.
+func loadStoredPlan(ctx context.Context, id string) (models.Plan, string, error) {
+	var plan models.Plan
+	if !middleware.ValidPlanId(id) {
+		return plan, "", planNotFound(id)
+	}
+	vals, err := config.RedisClient.MGet(ctx, id, id+":etag").Result()
+	if err != nil {
+		return plan, "", problem.Internal("Failed to retrieve plan", err)
+	}
+	val, ok := vals[0].(string)
+	if !ok {
+		return plan, "", planNotFound(id)
+	}
+	if err := json.Unmarshal([]byte(val), &plan); err != nil || plan.ObjectType != "plan" {
+		return plan, "", planNotFound(id)
+	}
+	etag, _ := vals[1].(string)
+	return plan, etag, nil
+}
+
+func DeletePlan(c *fiber.Ctx) error {
 	id := c.Params("id")
-	ctx := context.Background()
+	if err := deletePlan(c.UserContext(), id, c.Get("If-Match")); err != nil {
+		return err
+	}
 
-	// Retrieve existing plan from Redis
-	val, err := config.RedisClient.Get(ctx, id).Result()
-	if err == redis.Nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
-	} else if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve plan"})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Plan moved to trash",
+		"objectId":   id,
+		"purgeAfter": trash.Retention().String(),
+	})
+}
+
+// deletePlan moves a plan to the trash, checking ifMatch when given, then
+// records and publishes the delete. It backs DELETE /plans/:id, the
+// deletePlan mutation and the gRPC Delete.
+func deletePlan(ctx context.Context, id, ifMatch string) error {
+	var val, storedETag string
+	var plan models.Plan
+	var seq *redis.IntCmd
+
+	if !middleware.ValidPlanId(id) {
+		return planNotFound(id)
 	}
 
-	// Retrieve stored ETag
-	storedETag, err := config.RedisClient.Get(ctx, id+":etag").Result()
-	storedETag = strings.Trim(storedETag, "\"")
-	// fmt.Print(storedETag)
-	if err == redis.Nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "ETag not found"})
-	} else if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve ETag"})
+	// Read, check If-Match and tombstone under WATCH so a concurrent write
+	// aborts the delete instead of being silently thrown away
+	err := config.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		val, err = tx.Get(ctx, id).Result()
+		if err == redis.Nil {
+			return planNotFound(id)
+		} else if err != nil {
+			return err
+		}
+		storedETag, err = tx.Get(ctx, id+":etag").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		if ifMatch != "" && !etagMatches(ifMatch, storedETag) {
+			return problem.PreconditionFailed("Plan has been modified, delete aborted").WithObject(id)
+		}
+
+		// Unmarshal the plan for the delete event
+		if err := json.Unmarshal([]byte(val), &plan); err != nil {
+			return err
+		}
+
+		// Soft delete: the plan moves to the trash and is purged later. The
+		// trash holds one copy per id, so the copy left by an earlier delete
+		// of a recreated plan is replaced; its content stays in the version
+		// history.
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			trash.Move(ctx, pipe, id, currentAuthor(ctx))
+			seq = events.Next(ctx, pipe, id)
+			if err := versions.AppendDelete(ctx, pipe, id, currentAuthor(ctx)); err != nil {
+				return err
+			}
+			return queueAudit(ctx, pipe, "delete", id, storedETag, "", []byte(val), nil)
+		})
+		return err
+	}, id, id+":etag", trash.Prefix+id)
+
+	if err := txProblem(err, id, "Plan has been modified, delete aborted", "Failed to delete plan"); err != nil {
+		return err
 	}
 
+	// Publish delete message to RabbitMQ
+	msg := events.New("delete", plan, storedETag, currentAuthor(ctx), seq.Val())
+	if err := config.Events.Publish(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish delete message", "objectId", id, "error", err)
+	}
+
+	return nil
+}
+
+func PatchPlan(c *fiber.Ctx) error {
+	id := c.Params("id")
+
 	// Enforce If-Match header
 	ifMatch := c.Get("If-Match")
 	if ifMatch == "" {
-		return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{"error": "If-Match header is required"})
+		return problem.PreconditionRequired("If-Match header is required")
 	}
-	if ifMatch != storedETag && ifMatch != "\""+storedETag+"\"" {
-		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": "Plan has been modified, update aborted"})
+
+	// Parse incoming update data
+	var updatePlan models.Plan
+	if err := c.BodyParser(&updatePlan); err != nil {
+		return problem.BadRequest(problem.CodeInvalidJSON, "Invalid request format").WithCause(err)
 	}
 
-	// Parse existing plan
+	plan, newETag, err := patchPlan(c.UserContext(), id, ifMatch, func(plan *models.Plan) error {
+		return mergePlan(plan, updatePlan)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Return updated plan with new ETag
+	c.Set("ETag", newETag)
+	return c.Status(fiber.StatusOK).JSON(plan)
+}
+
+// patchPlan applies merge to the stored plan if ifMatch still matches its
+// ETag, then records and publishes the write. It backs PATCH /plans/:id,
+// the patchPlan mutation and the gRPC Patch, and returns the merged plan
+// and its new ETag.
+func patchPlan(ctx context.Context, id, ifMatch string, merge func(plan *models.Plan) error) (models.Plan, string, error) {
+	var val, storedETag, newETag string
 	var existingPlan models.Plan
-	if err := json.Unmarshal([]byte(val), &existingPlan); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse existing plan"})
+	var updatedPlanJSON []byte
+	var seq *redis.IntCmd
+
+	if !middleware.ValidPlanId(id) {
+		return models.Plan{}, "", planNotFound(id)
 	}
 
-	// Parse incoming update data
-	var updatePlan models.Plan
-	if err := c.BodyParser(&updatePlan); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
+	// Read-check-write as an optimistic transaction: if another writer
+	// touches the plan between our read and our write, EXEC fails and the
+	// client has to retry with the new ETag instead of losing an update
+	err := config.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		var err error
+
+		// Retrieve existing plan from Redis
+		val, err = tx.Get(ctx, id).Result()
+		if err == redis.Nil {
+			return planNotFound(id)
+		} else if err != nil {
+			return err
+		}
+
+		// Retrieve stored ETag
+		storedETag, err = tx.Get(ctx, id+":etag").Result()
+		if err == redis.Nil {
+			return problem.Internal("ETag not found", err)
+		} else if err != nil {
+			return err
+		}
+		if !etagMatches(ifMatch, storedETag) {
+			return problem.PreconditionFailed("Plan has been modified, update aborted").WithObject(id)
+		}
+
+		// Parse existing plan
+		existingPlan = models.Plan{}
+		if err := json.Unmarshal([]byte(val), &existingPlan); err != nil {
+			return problem.Internal("Failed to parse existing plan", err)
+		}
+
+		if err := merge(&existingPlan); err != nil {
+			return err
+		}
+
+		// Generate new ETag
+		updatedPlanJSON, _ = json.Marshal(existingPlan)
+		newETag = fmt.Sprintf("\"%x\"", sha256.Sum256(updatedPlanJSON))
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, id, updatedPlanJSON, 0)
+			pipe.Set(ctx, id+":etag", newETag, 0)
+			seq = events.Next(ctx, pipe, id)
+			if err := versions.Append(ctx, pipe, id, newETag, currentAuthor(ctx), updatedPlanJSON); err != nil {
+				return err
+			}
+			return queueAudit(ctx, pipe, "patch", id, storedETag, newETag, []byte(val), updatedPlanJSON)
+		})
+		return err
+	}, id, id+":etag")
+
+	if err := txProblem(err, id, "Plan has been modified, update aborted", "Failed to update plan"); err != nil {
+		return models.Plan{}, "", err
+	}
+
+	msg := events.New("patch", existingPlan, newETag, currentAuthor(ctx), seq.Val())
+
+	if err := config.Events.Publish(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish patch message", "objectId", id, "error", err)
 	}
 
+	return existingPlan, newETag, nil
+}
+
+// mergePlan applies a partial update onto an existing plan in place. Only
+// fields present in the update are changed, and linked services are
+// replaced or appended by objectId.
+func mergePlan(existingPlan *models.Plan, updatePlan models.Plan) error {
 	// Validate ObjectId consistency
 	if updatePlan.ObjectId != "" && updatePlan.ObjectId != existingPlan.ObjectId {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ObjectId mismatch in plan"})
+		return problem.Validation(problem.FieldError{Field: "objectId", Message: "ObjectId mismatch in plan"})
 	}
 
 	// Apply updates only to provided fields
 	if updatePlan.PlanCostShares != nil {
 		if existingPlan.PlanCostShares != nil {
 			if existingPlan.PlanCostShares.ObjectId != updatePlan.PlanCostShares.ObjectId {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ObjectId mismatch in PlanCostShares"})
+				return problem.Validation(problem.FieldError{Field: "planCostShares.objectId", Message: "ObjectId mismatch in PlanCostShares"})
 			}
 			// Apply non-zero updates
 			if updatePlan.PlanCostShares.Deductible != 0 {
@@ -416,31 +549,34 @@ func PatchPlan(c *fiber.Ctx) error {
 		existingPlan.Org = updatePlan.Org
 	}
 
-	// Generate new ETag
-	updatedPlanJSON, _ := json.Marshal(existingPlan)
-	newETag := fmt.Sprintf("\"%x\"", sha256.Sum256(updatedPlanJSON))
+	return nil
+}
 
-	// Atomic Redis transaction
-	pipe := config.RedisClient.TxPipeline()
-	pipe.Set(ctx, id, updatedPlanJSON, 0)
-	pipe.Set(ctx, id+":etag", newETag, 0)
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update plan"})
+// validatePlan checks that a plan has every objectId needed to store and
+// index it, reporting each missing one.
+func validatePlan(plan models.Plan) []problem.FieldError {
+	var errs []problem.FieldError
+	if plan.ObjectId == "" {
+		errs = append(errs, problem.FieldError{Field: "objectId", Message: "ObjectId is required"})
+	} else if !middleware.ValidPlanId(plan.ObjectId) {
+		errs = append(errs, problem.FieldError{Field: "objectId", Message: "ObjectId must not contain ':'"})
 	}
-
-	// Return updated plan with new ETag
-	c.Set("ETag", newETag)
-
-	msg := models.PlanMessage{
-		Operation: "patch",
-		Plan:      existingPlan,
+	if plan.PlanCostShares == nil || plan.PlanCostShares.ObjectId == "" {
+		errs = append(errs, problem.FieldError{Field: "planCostShares.objectId", Message: "PlanCostShares and its ObjectId are required"})
 	}
-
-	rmq := &rabbitmq.Factory{}
-	if err := rmq.PublishMessage("plans_queue", msg); err != nil {
-		log.Printf("Failed to publish patch message: %v", err)
+	if len(plan.LinkedPlanServices) == 0 {
+		errs = append(errs, problem.FieldError{Field: "linkedPlanServices", Message: "At least one LinkedPlanService is required"})
 	}
-
-	return c.Status(fiber.StatusOK).JSON(existingPlan)
+	for i, service := range plan.LinkedPlanServices {
+		if service.ObjectId == "" {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("linkedPlanServices[%d].objectId", i), Message: "LinkedPlanService ObjectId is required"})
+		}
+		if service.LinkedService.ObjectId == "" {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("linkedPlanServices[%d].linkedService.objectId", i), Message: "LinkedService ObjectId is required"})
+		}
+		if service.PlanServiceCostShares.ObjectId == "" {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("linkedPlanServices[%d].planserviceCostShares.objectId", i), Message: "PlanServiceCostShares ObjectId is required"})
+		}
+	}
+	return errs
 }
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/audit"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/redistest"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/trash"
+	"github.com/gofiber/fiber/v2"
+)
+
+// recorder is a broker.EventPublisher that keeps what it is given.
+type recorder struct {
+	mu     sync.Mutex
+	events []models.PlanMessage
+}
+
+func (r *recorder) Publish(_ context.Context, events ...models.PlanMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, events...)
+	return nil
+}
+
+func (r *recorder) operations() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ops := make([]string, len(r.events))
+	for i, event := range r.events {
+		ops[i] = event.Operation
+	}
+	return ops
+}
+
+// setupStore points the controllers at an in-memory Redis and returns the
+// publisher their events go to.
+func setupStore(t *testing.T) *recorder {
+	t.Helper()
+	redistest.Start(t)
+	events := &recorder{}
+	previous := config.Events
+	config.Events = events
+	t.Cleanup(func() { config.Events = previous })
+	return events
+}
+
+func testPlan(id string) models.Plan {
+	return models.Plan{
+		ObjectId:     id,
+		ObjectType:   "plan",
+		Org:          "example.com",
+		CreationDate: "12-12-2017",
+		PlanCostShares: &models.PlanCostShares{
+			ObjectId: id + "-costs", ObjectType: "membercostshare", Org: "example.com", Deductible: 2000, Copay: 23,
+		},
+		LinkedPlanServices: []models.LinkedPlanService{{
+			ObjectId:   id + "-service",
+			ObjectType: "planservice",
+			Org:        "example.com",
+			LinkedService: models.LinkedService{
+				ObjectId: id + "-checkup", ObjectType: "service", Org: "example.com", Name: "Yearly physical",
+			},
+			PlanServiceCostShares: models.PlanServiceCostShares{
+				ObjectId: id + "-service-costs", ObjectType: "membercostshare", Org: "example.com", Copay: 0,
+			},
+		}},
+	}
+}
+
+func TestDeleteRecreatedPlan(t *testing.T) {
+	events := setupStore(t)
+	ctx := context.Background()
+
+	first := testPlan("plan-1")
+	if _, err := createPlan(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := deletePlan(ctx, first.ObjectId, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	second := testPlan("plan-1")
+	second.CreationDate = "01-01-2024"
+	if _, err := createPlan(ctx, second); err != nil {
+		t.Fatalf("create after delete: %v", err)
+	}
+
+	// The live plan is never restored over
+	if _, _, err := trash.Restore(ctx, "plan-1", "", nil); !errors.Is(err, trash.ErrExists) {
+		t.Errorf("restore over a live plan = %v, want trash.ErrExists", err)
+	}
+
+	if err := deletePlan(ctx, second.ObjectId, ""); err != nil {
+		t.Fatalf("delete of the recreated plan: %v", err)
+	}
+	var p *problem.Problem
+	if _, _, err := loadStoredPlan(ctx, "plan-1"); !errors.As(err, &p) || p.Code != problem.CodePlanNotFound {
+		t.Errorf("load after delete = %v, want plan-not-found", err)
+	}
+
+	// The trash now holds the second copy
+	restored, _, err := trash.Restore(ctx, "plan-1", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.CreationDate != second.CreationDate {
+		t.Errorf("restored creationDate = %q, want %q", restored.CreationDate, second.CreationDate)
+	}
+
+	want := []string{"create", "delete", "create", "delete"}
+	if ops := events.operations(); !slices.Equal(ops, want) {
+		t.Errorf("published %v, want %v", ops, want)
+	}
+}
+
+func TestWritesRecordAudit(t *testing.T) {
+	setupStore(t)
+	ctx := context.Background()
+
+	etag, err := createPlan(ctx, testPlan("plan-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A write that fails leaves no entry behind
+	if _, err := createPlan(ctx, testPlan("plan-1")); err == nil {
+		t.Fatal("second create succeeded, want a conflict")
+	}
+	if _, _, err := patchPlan(ctx, "plan-1", `"stale"`, func(*models.Plan) error { return nil }); err == nil {
+		t.Fatal("patch with a stale If-Match succeeded")
+	}
+	_, etag, err = patchPlan(ctx, "plan-1", etag, func(plan *models.Plan) error {
+		plan.CreationDate = "01-01-2024"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := deletePlan(ctx, "plan-1", etag); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: problem.Handler})
+	app.Post("/plans/:id/restore", RestoreTrashedPlan)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/plans/plan-1/restore", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("restore status = %d", resp.StatusCode)
+	}
+
+	entries, err := audit.ForPlan(ctx, "plan-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, entry := range entries {
+		ops = append(ops, entry.Operation)
+	}
+	if want := []string{"create", "patch", "delete", "undelete"}; !slices.Equal(ops, want) {
+		t.Errorf("audit entries %v, want %v", ops, want)
+	}
+}
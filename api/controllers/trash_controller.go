@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/events"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/trash"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func ListTrash(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	list, err := trash.List(ctx)
+	if err != nil {
+		return problem.Internal("Failed to retrieve trash", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(list)
+}
+
+func RestoreTrashedPlan(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+
+	var etag string
+	plan, seq, err := trash.Restore(ctx, id, currentAuthor(ctx), func(pipe redis.Pipeliner, planETag string, after []byte) error {
+		etag = planETag
+		return queueAudit(ctx, pipe, "undelete", id, "", etag, nil, after)
+	})
+	if errors.Is(err, trash.ErrNotFound) {
+		return problem.NotFound(problem.CodePlanNotFound, "Plan not found in trash").WithObject(id)
+	} else if errors.Is(err, trash.ErrExists) {
+		return problem.Conflict(problem.CodePlanExists, "Plan already exists").WithObject(id)
+	} else if err != nil {
+		return problem.Internal("Failed to restore plan", err)
+	}
+
+	c.Set("ETag", etag)
+
+	// The index dropped the documents on delete, so rebuild them
+	msg := events.New("create", plan, etag, currentAuthor(ctx), seq)
+	if err := config.Events.Publish(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish restore message", "objectId", id, "error", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(plan)
+}
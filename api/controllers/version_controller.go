@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/events"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/middleware"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/utils"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/versions"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func ListPlanVersions(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+
+	list, err := versions.List(ctx, id)
+	if err != nil {
+		return problem.Internal("Failed to retrieve plan versions", err)
+	}
+	if len(list) == 0 {
+		return planNotFound(id)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(list)
+}
+
+func GetPlanVersion(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+
+	n, err := c.ParamsInt("n")
+	if err != nil {
+		return problem.BadRequest(problem.CodeInvalidParameter, "Version must be a number")
+	}
+
+	version, err := versions.Get(ctx, id, int64(n))
+	if errors.Is(err, versions.ErrNotFound) {
+		return problem.NotFound(problem.CodeVersionNotFound, "Version not found").WithObject(id)
+	} else if err != nil {
+		return problem.Internal("Failed to retrieve plan version", err)
+	}
+
+	c.Set("ETag", version.ETag)
+	return c.Status(fiber.StatusOK).JSON(version)
+}
+
+func getPlanAsOf(c *fiber.Ctx, id, asOf string, shape *utils.JSONShape) error {
+	ctx := c.UserContext()
+	t, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return problem.BadRequest(problem.CodeInvalidParameter, "asOf must be an RFC 3339 timestamp").WithCause(err)
+	}
+
+	version, err := versions.AsOf(ctx, id, t)
+	if errors.Is(err, versions.ErrNotFound) || version.Deleted {
+		return planNotFound(id)
+	} else if err != nil {
+		return problem.Internal("Failed to retrieve plan version", err)
+	}
+
+	return sendPlan(c, *version.Plan, version.ETag, shape)
+}
+
+func RestorePlanVersion(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+
+	n, err := c.ParamsInt("n")
+	if err != nil {
+		return problem.BadRequest(problem.CodeInvalidParameter, "Version must be a number")
+	}
+
+	ifMatch := c.Get("If-Match")
+	if ifMatch == "" {
+		return problem.PreconditionRequired("If-Match header is required")
+	}
+
+	version, err := versions.Get(ctx, id, int64(n))
+	if errors.Is(err, versions.ErrNotFound) {
+		return problem.NotFound(problem.CodeVersionNotFound, "Version not found").WithObject(id)
+	} else if err != nil {
+		return problem.Internal("Failed to retrieve plan version", err)
+	}
+	if version.Deleted {
+		return problem.BadRequest(problem.CodeInvalidParameter, "Version records a deletion and has no plan to restore").WithObject(id)
+	}
+
+	planJSON, err := json.Marshal(version.Plan)
+	if err != nil {
+		return problem.Internal("Failed to marshal plan", err)
+	}
+	newETag := fmt.Sprintf("\"%x\"", sha256.Sum256(planJSON))
+
+	// Restoring is a write like any other: it needs the current ETag and
+	// runs under WATCH like PatchPlan
+	var current, storedETag string
+	var seq *redis.IntCmd
+	err = config.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		storedETag, err = tx.Get(ctx, id+":etag").Result()
+		if err == redis.Nil {
+			return planNotFound(id)
+		} else if err != nil {
+			return err
+		}
+		if current, err = tx.Get(ctx, id).Result(); err != nil {
+			return err
+		}
+		if !etagMatches(ifMatch, storedETag) {
+			return problem.PreconditionFailed("Plan has been modified, restore aborted").WithObject(id)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, id, planJSON, 0)
+			pipe.Set(ctx, id+":etag", newETag, 0)
+			seq = events.Next(ctx, pipe, id)
+			if err := versions.Append(ctx, pipe, id, newETag, currentAuthor(ctx), planJSON); err != nil {
+				return err
+			}
+			return queueAudit(ctx, pipe, "restore", id, storedETag, newETag, []byte(current), planJSON)
+		})
+		return err
+	}, id, id+":etag")
+
+	if err := txProblem(err, id, "Plan has been modified, restore aborted", "Failed to restore plan"); err != nil {
+		return err
+	}
+
+	c.Set("ETag", newETag)
+
+	msg := events.New("patch", *version.Plan, newETag, currentAuthor(ctx), seq.Val())
+	if err := config.Events.Publish(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish restore message", "objectId", id, "error", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(version.Plan)
+}
+
+// currentAuthor identifies the caller in version history, preferring the
+// email over the opaque subject.
+func currentAuthor(ctx context.Context) string {
+	subject, email := middleware.UserFromContext(ctx)
+	if email != "" {
+		return email
+	}
+	return subject
+}
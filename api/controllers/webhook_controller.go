@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/webhooks"
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultDeliveryLimit = 50
+
+func CreateWebhook(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	var w models.Webhook
+	if err := c.BodyParser(&w); err != nil {
+		return problem.BadRequest(problem.CodeInvalidJSON, "Invalid JSON format").WithCause(err)
+	}
+	if errs := validateWebhook(w); len(errs) > 0 {
+		return problem.Validation(errs...)
+	}
+
+	w.CreatedBy = currentAuthor(ctx)
+	w, err := webhooks.Create(ctx, w)
+	if err != nil {
+		return problem.Internal("Failed to store webhook", err)
+	}
+
+	// The secret is only ever shown here
+	return c.Status(fiber.StatusCreated).JSON(w)
+}
+
+func ListWebhooks(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	list, err := webhooks.List(ctx)
+	if err != nil {
+		return problem.Internal("Failed to retrieve webhooks", err)
+	}
+	for i := range list {
+		list[i].Secret = ""
+	}
+	return c.Status(fiber.StatusOK).JSON(list)
+}
+
+func GetWebhook(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	w, err := webhooks.Get(ctx, c.Params("id"))
+	if err != nil {
+		return webhookProblem(err, c.Params("id"), "Failed to retrieve webhook")
+	}
+	w.Secret = ""
+	return c.Status(fiber.StatusOK).JSON(w)
+}
+
+// UpdateWebhook replaces the URL and filters of a webhook. The secret is
+// rotated only when the body carries a new one.
+func UpdateWebhook(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+	var update models.Webhook
+	if err := c.BodyParser(&update); err != nil {
+		return problem.BadRequest(problem.CodeInvalidJSON, "Invalid JSON format").WithCause(err)
+	}
+	if errs := validateWebhook(update); len(errs) > 0 {
+		return problem.Validation(errs...)
+	}
+
+	w, err := webhooks.Update(ctx, id, update)
+	if err != nil {
+		return webhookProblem(err, id, "Failed to update webhook")
+	}
+	w.Secret = ""
+	return c.Status(fiber.StatusOK).JSON(w)
+}
+
+func DeleteWebhook(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+	if err := webhooks.Delete(ctx, id); err != nil {
+		return webhookProblem(err, id, "Failed to delete webhook")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook, newest
+// first, up to ?limit entries.
+func ListWebhookDeliveries(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+	limit := c.QueryInt("limit", defaultDeliveryLimit)
+	if limit < 1 {
+		return problem.BadRequest(problem.CodeInvalidParameter, "limit must be a positive integer")
+	}
+
+	if _, err := webhooks.Get(ctx, id); err != nil {
+		return webhookProblem(err, id, "Failed to retrieve webhook")
+	}
+	deliveries, err := webhooks.Deliveries(ctx, id, int64(limit))
+	if err != nil {
+		return problem.Internal("Failed to retrieve deliveries", err)
+	}
+	return c.Status(fiber.StatusOK).JSON(deliveries)
+}
+
+// RedeliverWebhook sends the payload of an earlier delivery again, once,
+// and returns the outcome. A failed redelivery is still a 200: the
+// delivery itself reports what the receiver answered.
+func RedeliverWebhook(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := c.Params("id")
+
+	delivery, err := webhooks.NewDispatcher().Redeliver(ctx, id, c.Params("deliveryId"))
+	if err != nil {
+		return webhookProblem(err, id, "Failed to redeliver")
+	}
+	return c.Status(fiber.StatusOK).JSON(delivery)
+}
+
+func webhookProblem(err error, id, detail string) error {
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		return problem.NotFound(problem.CodeWebhookNotFound, "Webhook not found").WithObject(id)
+	case errors.Is(err, webhooks.ErrDeliveryNotFound):
+		return problem.NotFound(problem.CodeDeliveryNotFound, "Delivery not found").WithObject(id)
+	}
+	return problem.Internal(detail, err)
+}
+
+func validateWebhook(w models.Webhook) []problem.FieldError {
+	var errs []problem.FieldError
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, problem.FieldError{Field: "url", Message: "An absolute http or https URL is required"})
+	} else if err := webhooks.CheckURL(w.URL); err != nil {
+		errs = append(errs, problem.FieldError{Field: "url", Message: "The URL must not point at a private or internal address"})
+	}
+	for i, event := range w.Events {
+		if !slices.Contains(webhooks.EventTypes, event) {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("events[%d]", i), Message: "Unknown event type " + event})
+		}
+	}
+	return errs
+}
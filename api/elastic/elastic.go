@@ -1,7 +1,7 @@
 package elastic
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/elastic/go-elasticsearch/v8"
 )
@@ -19,9 +19,9 @@ func NewElasticFactory() *Factory {
 func (f *Factory) NewClient(cfg elasticsearch.Config) (*Client, error) {
 	es, err := elasticsearch.NewClient(cfg)
 	if err != nil {
-		log.Printf("Error creating the elasticsearch client: %s", err)
+		slog.Error("Error creating the elasticsearch client", "error", err)
 		return nil, err
 	}
 
 	return &Client{ES: es}, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// SchemaVersion is the version of the PlanMessage contract. Messages
+// without one predate the envelope and carry no sequence.
+const SchemaVersion = 2
+
+// Every write to a plan increments its counter under <objectId>:seq. The
+// counter outlives the plan, including purges, so an id that is reused
+// never produces events older than the ones already indexed.
+const SequenceSuffix = ":seq"
+
+// Next queues the increment of a plan's sequence onto pipe, so the event
+// is numbered in the same transaction as the write it describes.
+func Next(ctx context.Context, pipe redis.Pipeliner, objectId string) *redis.IntCmd {
+	return pipe.Incr(ctx, objectId+SequenceSuffix)
+}
+
+// New builds the event for a write to plan. etag is the ETag of the
+// representation the event carries.
+func New(operation string, plan models.Plan, etag, actor string, sequence int64) models.PlanMessage {
+	return models.PlanMessage{
+		EventId:       uuid.NewString(),
+		SchemaVersion: SchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		Actor:         actor,
+		ETag:          etag,
+		Sequence:      sequence,
+		Operation:     operation,
+		Plan:          plan,
+	}
+}
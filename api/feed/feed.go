@@ -0,0 +1,176 @@
+package feed
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/broker"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// The change feed is a capped stream of recent plan events. Its entry IDs
+// are the SSE event IDs, so a client that reconnects with Last-Event-ID is
+// replayed everything it missed, as long as the stream still holds it.
+const (
+	Stream        = "plans:feed"
+	defaultMaxLen = 10000
+)
+
+// ErrTrimmed is returned by Since when events after the given ID have
+// already been trimmed from the stream, so resuming from it would skip
+// them.
+var ErrTrimmed = errors.New("feed trimmed past last event id")
+
+// Entry is one event in the feed.
+type Entry struct {
+	ID    string
+	Event models.PlanMessage
+}
+
+// Filter narrows the feed to some plans or orgs. Empty lists match
+// everything.
+type Filter struct {
+	ObjectIds []string
+	Orgs      []string
+}
+
+func (f Filter) Matches(event models.PlanMessage) bool {
+	if len(f.ObjectIds) > 0 && !slices.Contains(f.ObjectIds, event.Plan.ObjectId) {
+		return false
+	}
+	return len(f.Orgs) == 0 || slices.Contains(f.Orgs, event.Plan.Org)
+}
+
+// Publisher records every event in the feed before handing it on to the
+// publisher it wraps. The feed follows the writes, not the broker, so
+// events are recorded even when publishing them fails.
+type Publisher struct {
+	broker.EventPublisher
+	maxLen int64
+}
+
+// NewPublisher wraps next. FEED_MAXLEN is roughly how many events the
+// feed keeps for resuming clients.
+func NewPublisher(next broker.EventPublisher) Publisher {
+	return Publisher{
+		EventPublisher: next,
+		maxLen:         int64(config.IntFromEnv("FEED_MAXLEN", defaultMaxLen)),
+	}
+}
+
+func (p Publisher) Publish(ctx context.Context, events ...models.PlanMessage) error {
+	if err := p.append(ctx, events); err != nil {
+		slog.ErrorContext(ctx, "Failed to record events in the feed", "count", len(events), "error", err)
+	}
+	return p.EventPublisher.Publish(ctx, events...)
+}
+
+func (p Publisher) append(ctx context.Context, events []models.PlanMessage) error {
+	pipe := config.RedisClient.Pipeline()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event %s: %w", event.EventId, err)
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: Stream,
+			MaxLen: p.maxLen,
+			Approx: true,
+			Values: map[string]interface{}{"event": data},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Since returns the entries after lastId, oldest first. Only losing an
+// entry after lastId is ErrTrimmed; lastId itself may be gone.
+func Since(ctx context.Context, lastId string) ([]Entry, error) {
+	info, err := config.RedisClient.XInfoStream(ctx, Stream).Result()
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "ERR no such key") {
+		return []Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if trimmedPast(info, lastId) {
+		return nil, ErrTrimmed
+	}
+
+	msgs, err := config.RedisClient.XRange(ctx, Stream, lastId, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.ID == lastId {
+			continue
+		}
+		entry, err := decode(msg)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// trimmedPast reports whether entries after lastId have been trimmed. The
+// feed is only ever trimmed from the front, so that is when the newest
+// entry removed from it is after lastId. Redis before 7.0 does not report
+// that entry, and then any gap before the oldest entry counts, which can
+// reset a client that missed nothing.
+func trimmedPast(info *redis.XInfoStream, lastId string) bool {
+	if info.MaxDeletedEntryID != "" {
+		return CompareIDs(info.MaxDeletedEntryID, lastId) > 0
+	}
+	return info.FirstEntry.ID != "" && CompareIDs(info.FirstEntry.ID, lastId) > 0
+}
+
+func decode(msg redis.XMessage) (Entry, error) {
+	entry := Entry{ID: msg.ID}
+	raw, _ := msg.Values["event"].(string)
+	if err := json.Unmarshal([]byte(raw), &entry.Event); err != nil {
+		return entry, fmt.Errorf("corrupt feed entry %s: %w", msg.ID, err)
+	}
+	return entry, nil
+}
+
+// ValidID reports whether id is a stream entry ID, as sent in Last-Event-ID.
+func ValidID(id string) bool {
+	_, _, ok := parseID(id)
+	return ok
+}
+
+// CompareIDs orders two valid entry IDs like cmp.Compare.
+func CompareIDs(a, b string) int {
+	ams, aseq, _ := parseID(a)
+	bms, bseq, _ := parseID(b)
+	return cmp.Or(cmp.Compare(ams, bms), cmp.Compare(aseq, bseq))
+}
+
+// parseID splits an entry ID of the form <milliseconds>-<sequence>.
+func parseID(id string) (ms, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
@@ -0,0 +1,154 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Each API process tails the stream once and fans new entries out to its
+// subscribers, so connected clients cost no Redis connections of their
+// own.
+const (
+	subscriberBuffer = 256
+	readBlock        = 5 * time.Second
+	readCount        = 100
+	retryDelay       = time.Second
+)
+
+var hub = struct {
+	mu     sync.Mutex
+	closed bool
+	subs   map[*Subscription]struct{}
+}{subs: map[*Subscription]struct{}{}}
+
+// Subscription receives the entries matching its filter as they are
+// appended. C is closed when the feed stops or the subscriber falls too
+// far behind; either way the client should reconnect and resume from the
+// stream.
+type Subscription struct {
+	C      <-chan Entry
+	c      chan Entry
+	filter Filter
+}
+
+func Subscribe(filter Filter) *Subscription {
+	c := make(chan Entry, subscriberBuffer)
+	s := &Subscription{C: c, c: c, filter: filter}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.closed {
+		close(c)
+	} else {
+		hub.subs[s] = struct{}{}
+	}
+	return s
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	drop(s)
+}
+
+// drop removes a subscriber and closes its channel. hub.mu must be held.
+func drop(s *Subscription) {
+	if _, ok := hub.subs[s]; ok {
+		delete(hub.subs, s)
+		close(s.c)
+	}
+}
+
+func broadcast(entry Entry) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for s := range hub.subs {
+		if !s.filter.Matches(entry.Event) {
+			continue
+		}
+		select {
+		case s.c <- entry:
+		default:
+			slog.Warn("Feed subscriber fell behind, disconnecting", "entryId", entry.ID)
+			drop(s)
+		}
+	}
+}
+
+// Start tails the feed until ctx is cancelled, at which point every
+// subscription is closed so open streams end and in-flight requests can
+// finish.
+func Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		hub.closed = true
+		for s := range hub.subs {
+			drop(s)
+		}
+	}()
+	go tail(ctx)
+}
+
+// tail reads the stream from its current end onwards. It keeps track of
+// the last entry it read, so nothing is skipped across Redis errors.
+func tail(ctx context.Context) {
+	var last string
+	for ctx.Err() == nil {
+		msgs, err := config.RedisClient.XRevRangeN(ctx, Stream, "+", "-", 1).Result()
+		if err == nil {
+			last = "0-0"
+			if len(msgs) > 0 {
+				last = msgs[0].ID
+			}
+			break
+		}
+		slog.Warn("Failed to read the feed, retrying", "in", retryDelay, "error", err)
+		sleep(ctx, retryDelay)
+	}
+
+	for ctx.Err() == nil {
+		streams, err := config.RedisClient.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{Stream, last},
+			Count:   readCount,
+			Block:   readBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to read the feed, retrying", "in", retryDelay, "error", err)
+			sleep(ctx, retryDelay)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				last = msg.ID
+				entry, err := decode(msg)
+				if err != nil {
+					slog.Error("Skipping feed entry", "error", err)
+					continue
+				}
+				broadcast(entry)
+			}
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
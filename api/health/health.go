@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/rabbitmq"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	// checkTimeout bounds every dependency check so a hung dependency
+	// cannot hang the probe
+	checkTimeout = 2 * time.Second
+)
+
+// Check reports whether one dependency is usable.
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the body of a readiness probe. Details carries extra state a
+// service wants to expose, such as the last message it processed.
+type Report struct {
+	Status  string                 `json:"status"`
+	Checks  map[string]CheckResult `json:"checks"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusUp
+}
+
+// Run runs all checks concurrently and collects their results.
+func Run(ctx context.Context, checks map[string]Check) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+
+			result := CheckResult{Status: StatusUp, Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func Redis(client *redis.Client) Check {
+	return func(ctx context.Context) error {
+		if client == nil {
+			return fmt.Errorf("redis client not initialised")
+		}
+		return client.Ping(ctx).Err()
+	}
+}
+
+// RabbitMQ checks the factory's shared publishing connection. Only when it
+// is closed does the check dial, which is the reconnect the next publish
+// would have to make anyway, and the dial is bounded by ctx.
+func RabbitMQ(f *rabbitmq.Factory) Check {
+	return func(ctx context.Context) error {
+		_, err := f.Connection(ctx)
+		return err
+	}
+}
+
+// Elasticsearch fails when the cluster is red or unreachable. A yellow
+// cluster still serves reads and writes, which is the normal state of a
+// single node. When index is set it must also exist.
+func Elasticsearch(es *elasticsearch.Client, index string) Check {
+	return func(ctx context.Context) error {
+		if es == nil {
+			return fmt.Errorf("elasticsearch client not initialised")
+		}
+
+		res, err := es.Cluster.Health(es.Cluster.Health.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			return fmt.Errorf("cluster health: %s", res.Status())
+		}
+
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			return fmt.Errorf("cluster health: %w", err)
+		}
+		if strings.EqualFold(body.Status, "red") {
+			return fmt.Errorf("cluster status is red")
+		}
+
+		if index == "" {
+			return nil
+		}
+		res, err = es.Indices.Exists([]string{index}, es.Indices.Exists.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			return fmt.Errorf("index %s: %s", index, res.Status())
+		}
+		return nil
+	}
+}
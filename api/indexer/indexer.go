@@ -0,0 +1,270 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/broker"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// Index is the Elasticsearch index plans are searched in.
+const Index = "plans"
+
+// Indexer keeps the plans index in step with plan events. Every plan is
+// stored as a tree of documents: the plan, its planCostShares and its
+// linkedPlanServices, which in turn own a linkedService and a
+// planserviceCostShares.
+type Indexer struct {
+	es *elasticsearch.Client
+
+	// Processed, when set, is told about every event handled
+	Processed func(operation, objectId string)
+}
+
+func New(es *elasticsearch.Client) *Indexer {
+	return &Indexer{es: es}
+}
+
+// Setup creates the plans index and applies the mapping. It only fails
+// when Elasticsearch cannot be reached; an index that already exists is
+// logged as before.
+func (ix *Indexer) Setup(ctx context.Context) error {
+	res, err := ix.es.Indices.Create(Index, ix.es.Indices.Create.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		slog.Info("Index not created", "index", Index, "response", res.String())
+	} else {
+		slog.Info("Index created", "index", Index)
+	}
+
+	// Put Mapping
+	jsonData, err := json.Marshal(mapping())
+	if err != nil {
+		return fmt.Errorf("failed to serialize the mapping: %w", err)
+	}
+
+	res, err = ix.es.Indices.PutMapping(
+		[]string{Index},
+		bytes.NewReader(jsonData),
+		ix.es.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		slog.Error("Error applying mapping", "index", Index, "response", res.String())
+	} else {
+		slog.Info("Mapping applied", "index", Index)
+	}
+	return nil
+}
+
+// Handle applies one event to the index. It is a broker.Handler, and only
+// fails when Elasticsearch cannot be reached or is overloaded, so the
+// event is worth delivering again.
+func (ix *Indexer) Handle(ctx context.Context, msg broker.Message) error {
+	event := msg.Event
+	slog.DebugContext(ctx, "Received message", "operation", event.Operation, "objectId", event.Plan.ObjectId,
+		"eventId", event.EventId, "sequence", event.Sequence)
+
+	// Writes carry the plan's sequence as the document version, so the
+	// index itself rejects events older than, or the same as, the one it
+	// holds. That makes redelivery safe to acknowledge.
+	current := true
+	var err error
+	switch event.Operation {
+	case "create":
+		current, err = ix.index(ctx, event.Plan, event.Sequence)
+	case "patch":
+		current, err = ix.index(ctx, event.Plan, event.Sequence)
+	case "delete":
+		current, err = ix.delete(ctx, event.Plan, event.Sequence)
+	default:
+		slog.WarnContext(ctx, "Unknown operation", "operation", event.Operation)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !current {
+		reason := "stale"
+		if msg.Redelivered {
+			reason = "duplicate"
+		}
+		metrics.EventsDiscarded.WithLabelValues(reason).Inc()
+		slog.InfoContext(ctx, "Discarded event", "reason", reason, "eventId", event.EventId,
+			"objectId", event.Plan.ObjectId, "sequence", event.Sequence)
+	}
+	if ix.Processed != nil {
+		ix.Processed(event.Operation, event.Plan.ObjectId)
+	}
+
+	metrics.MessagesProcessed.WithLabelValues(event.Operation).Inc()
+	if !msg.PublishedAt.IsZero() {
+		lag := time.Since(msg.PublishedAt)
+		metrics.IndexLag.WithLabelValues(event.Operation).Observe(lag.Seconds())
+	}
+	return nil
+}
+
+// index writes the plan and its children. It reports false when the plan
+// document was already at a newer sequence, in which case the event was
+// stale or a duplicate. The children are written regardless, so a
+// redelivery completes an event that was cut off halfway.
+func (ix *Indexer) index(ctx context.Context, plan models.Plan, seq int64) (bool, error) {
+	// Add the plan_join field to the plan object
+	plan.PlanJoin = map[string]interface{}{
+		"name": "plan",
+	}
+	current, err := ix.indexDocument(ctx, plan.ObjectId, "", plan, seq)
+	if err != nil {
+		return false, err
+	}
+
+	// Index the planCostShares document
+	plan.PlanCostShares.PlanJoin = map[string]interface{}{
+		"name":   "planCostShares",
+		"parent": plan.ObjectId,
+	}
+	if _, err := ix.indexDocument(ctx, plan.PlanCostShares.ObjectId, plan.ObjectId, plan.PlanCostShares, seq); err != nil {
+		return false, err
+	}
+
+	// Index each linkedPlanServices document with its linkedService and
+	// planserviceCostShares
+	for _, linkedPlanService := range plan.LinkedPlanServices {
+		linkedPlanService.PlanJoin = map[string]interface{}{
+			"name":   "linkedPlanServices",
+			"parent": plan.ObjectId,
+		}
+		if _, err := ix.indexDocument(ctx, linkedPlanService.ObjectId, plan.ObjectId, linkedPlanService, seq); err != nil {
+			return false, err
+		}
+
+		linkedPlanService.LinkedService.PlanJoin = map[string]interface{}{
+			"name":   "linkedService",
+			"parent": linkedPlanService.ObjectId,
+		}
+		if _, err := ix.indexDocument(ctx, linkedPlanService.LinkedService.ObjectId, linkedPlanService.ObjectId, linkedPlanService.LinkedService, seq); err != nil {
+			return false, err
+		}
+
+		linkedPlanService.PlanServiceCostShares.PlanJoin = map[string]interface{}{
+			"name":   "planserviceCostShares",
+			"parent": linkedPlanService.ObjectId,
+		}
+		if _, err := ix.indexDocument(ctx, linkedPlanService.PlanServiceCostShares.ObjectId, linkedPlanService.ObjectId, linkedPlanService.PlanServiceCostShares, seq); err != nil {
+			return false, err
+		}
+	}
+	return current, nil
+}
+
+// delete removes the plan and its children and, like index, reports
+// whether the event was current.
+func (ix *Indexer) delete(ctx context.Context, plan models.Plan, seq int64) (bool, error) {
+	ids := []string{plan.ObjectId, plan.PlanCostShares.ObjectId}
+	for _, linkedPlanService := range plan.LinkedPlanServices {
+		ids = append(ids,
+			linkedPlanService.ObjectId,
+			linkedPlanService.LinkedService.ObjectId,
+			linkedPlanService.PlanServiceCostShares.ObjectId,
+		)
+	}
+
+	var current bool
+	for i, id := range ids {
+		res, err := ix.es.Delete(Index, id, ix.es.Delete.WithContext(ctx), deleteVersion(seq))
+		applied, err := check(ctx, "delete", id, res, err)
+		if err != nil {
+			return false, err
+		}
+		if i == 0 {
+			current = applied
+		}
+	}
+	return current, nil
+}
+
+func (ix *Indexer) indexDocument(ctx context.Context, id, parent string, doc interface{}, seq int64) (bool, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return false, fmt.Errorf("failed to serialize document %s: %w", id, err)
+	}
+
+	opts := []func(*esapi.IndexRequest){
+		ix.es.Index.WithDocumentID(id),
+		ix.es.Index.WithContext(ctx),
+		ix.es.Index.WithRefresh("true"),
+		indexVersion(seq),
+	}
+	// Children live on their parent's shard
+	if parent != "" {
+		opts = append(opts, ix.es.Index.WithRouting(parent))
+	}
+	res, err := ix.es.Index(Index, bytes.NewReader(body), opts...)
+	return check(ctx, "index", id, res, err)
+}
+
+// check logs the outcome of a write to one document. It reports false when
+// the document was already at a newer sequence. Errors Elasticsearch may
+// get over, 429 and 5xx, fail the event so it is delivered again; any
+// other error, such as a mapping rejection, would fail every redelivery
+// too, so it is counted and logged instead.
+func check(ctx context.Context, action, id string, res *esapi.Response, err error) (bool, error) {
+	if err != nil {
+		return false, fmt.Errorf("failed to %s document %s: %w", action, id, err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusConflict:
+		slog.DebugContext(ctx, "Document already at a newer sequence", "action", action, "id", id)
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError:
+		metrics.IndexErrors.WithLabelValues(action).Inc()
+		return false, fmt.Errorf("failed to %s document %s: %s", action, id, res.String())
+	case res.IsError():
+		metrics.IndexErrors.WithLabelValues(action).Inc()
+		slog.ErrorContext(ctx, "Error writing document", "action", action, "id", id, "response", res.String())
+	default:
+		slog.DebugContext(ctx, "Wrote document", "action", action, "id", id)
+	}
+	return true, nil
+}
+
+// indexVersion makes an index request conditional on seq being newer than
+// the event that last wrote the document. Messages from before the event
+// envelope have no sequence and are written unconditionally.
+func indexVersion(seq int64) func(*esapi.IndexRequest) {
+	return func(r *esapi.IndexRequest) {
+		if seq > 0 {
+			version := int(seq)
+			r.Version = &version
+			r.VersionType = "external"
+		}
+	}
+}
+
+func deleteVersion(seq int64) func(*esapi.DeleteRequest) {
+	return func(r *esapi.DeleteRequest) {
+		if seq > 0 {
+			version := int(seq)
+			r.Version = &version
+			r.VersionType = "external"
+		}
+	}
+}
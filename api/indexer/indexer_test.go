@@ -0,0 +1,44 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		err         error
+		wantApplied bool
+		wantErr     bool
+	}{
+		{name: "written", status: 201, wantApplied: true},
+		{name: "newer sequence", status: 409},
+		{name: "unreachable", err: errors.New("connection refused"), wantErr: true},
+		{name: "too many requests", status: 429, wantErr: true},
+		{name: "unavailable", status: 503, wantErr: true},
+		{name: "mapping rejection", status: 400, wantApplied: true},
+		{name: "missing document", status: 404, wantApplied: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res *esapi.Response
+			if tt.err == nil {
+				res = &esapi.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader("{}"))}
+			}
+			applied, err := check(context.Background(), "index", "plan-1", res, tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if applied != tt.wantApplied {
+				t.Errorf("applied = %v, want %v", applied, tt.wantApplied)
+			}
+		})
+	}
+}
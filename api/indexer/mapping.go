@@ -0,0 +1,105 @@
+package indexer
+
+// mapping declares the join field that ties the documents of a plan
+// together, with the plan as the root.
+func mapping() map[string]interface{} {
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			"plan": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"_org": map[string]interface{}{
+						"type": "text",
+					},
+					"objectId": map[string]interface{}{
+						"type": "keyword",
+					},
+					"objectType": map[string]interface{}{
+						"type": "text",
+					},
+					"planType": map[string]interface{}{
+						"type": "text",
+					},
+					"creationDate": map[string]interface{}{
+						"type":   "date",
+						"format": "MM-dd-yyyy",
+					},
+				},
+			},
+			"planCostShares": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"copay": map[string]interface{}{
+						"type": "long",
+					},
+					"deductible": map[string]interface{}{
+						"type": "long",
+					},
+					"_org": map[string]interface{}{
+						"type": "text",
+					},
+					"objectId": map[string]interface{}{
+						"type": "keyword",
+					},
+					"objectType": map[string]interface{}{
+						"type": "text",
+					},
+				},
+			},
+			"linkedPlanServices": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"_org": map[string]interface{}{
+						"type": "text",
+					},
+					"objectId": map[string]interface{}{
+						"type": "keyword",
+					},
+					"objectType": map[string]interface{}{
+						"type": "text",
+					},
+				},
+			},
+			"linkedService": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"_org": map[string]interface{}{
+						"type": "text",
+					},
+					"name": map[string]interface{}{
+						"type": "text",
+					},
+					"objectId": map[string]interface{}{
+						"type": "keyword",
+					},
+					"objectType": map[string]interface{}{
+						"type": "text",
+					},
+				},
+			},
+			"planserviceCostShares": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"copay": map[string]interface{}{
+						"type": "long",
+					},
+					"deductible": map[string]interface{}{
+						"type": "long",
+					},
+					"_org": map[string]interface{}{
+						"type": "text",
+					},
+					"objectId": map[string]interface{}{
+						"type": "keyword",
+					},
+					"objectType": map[string]interface{}{
+						"type": "text",
+					},
+				},
+			},
+			"plan_join": map[string]interface{}{
+				"type":                  "join",
+				"eager_global_ordinals": "true",
+				"relations": map[string]interface{}{
+					"plan":               []string{"planCostShares", "linkedPlanServices"},
+					"linkedPlanServices": []string{"linkedService", "planserviceCostShares"},
+				},
+			},
+		},
+	}
+}
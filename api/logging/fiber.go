@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Middleware puts the request ID set by the requestid middleware into the
+// request context and writes one access log line per request. Errors are
+// rendered here so the logged status is the one the client gets.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	if id, ok := c.Locals("requestid").(string); ok {
+		c.SetUserContext(WithRequestID(c.UserContext(), id))
+	}
+
+	if err := c.Next(); err != nil {
+		if err := c.App().Config().ErrorHandler(c, err); err != nil {
+			return err
+		}
+	}
+
+	status := c.Response().StatusCode()
+	level := slog.LevelInfo
+	switch {
+	case status >= fiber.StatusInternalServerError:
+		level = slog.LevelError
+	case status >= fiber.StatusBadRequest:
+		level = slog.LevelWarn
+	}
+
+	slog.LogAttrs(c.UserContext(), level, "request",
+		slog.String("method", c.Method()),
+		slog.String("route", c.Route().Path),
+		slog.String("path", c.Path()),
+		slog.Int("status", status),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return nil
+}
@@ -1,14 +1,224 @@
 package main
 
 import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/broker"
 	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/controllers"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/feed"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/indexer"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/logging"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/middleware"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/rabbitmq"
 	"github.com/dumbresi/Healthcare-Plan-Management/api/routes"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/tracing"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/trash"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/webhooks"
+	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	defaultGRPCAddr        = ":9090"
+	indexerRetryDelay      = 5 * time.Second
 )
 
 func main() {
+	logging.Init("plans-api")
+
+	// SIGINT and SIGTERM cancel ctx, which starts the shutdown below
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(ctx, "plans-api")
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	config.InitRedis()
-	app := fiber.New()
+	trash.StartPurger(ctx)
+	feed.Start(ctx)
+
+	// EVENT_BUS=memory indexes plans and delivers webhooks inside the API
+	// over an in-process bus, so local development needs neither RabbitMQ
+	// nor the consumer
+	var bus *broker.Memory
+	var publisher *rabbitmq.Factory
+	var handlers sync.WaitGroup
+	if os.Getenv("EVENT_BUS") == "memory" {
+		bus = broker.NewMemory(rabbitmq.IndexerQueue.Name, rabbitmq.WebhooksQueue.Name)
+		config.Events = feed.NewPublisher(bus)
+		handlers.Add(2)
+		go func() {
+			defer handlers.Done()
+			runIndexer(ctx, bus.Queue(rabbitmq.IndexerQueue.Name))
+		}()
+		go func() {
+			defer handlers.Done()
+			runWebhooks(ctx, bus.Queue(rabbitmq.WebhooksQueue.Name))
+		}()
+	} else {
+		publisher = &rabbitmq.Factory{}
+		config.Events = feed.NewPublisher(publisher)
+	}
+
+	app := fiber.New(fiber.Config{
+		// Bulk imports carry thousands of plans in one body, which they
+		// read as it arrives; middleware.BodyLimit caps every other route
+		StreamRequestBody: true,
+		// Every error leaves the API as application/problem+json
+		ErrorHandler: problem.Handler,
+	})
+	app.Use(requestid.New())
+	app.Use(tracing.Middleware)
+	app.Use(logging.Middleware)
+	app.Use(metrics.Middleware)
 	routes.SetupRoutes(app)
-	app.Listen(":8080")
+
+	go func() {
+		if err := app.Listen(":8080"); err != nil {
+			slog.Error("Server stopped", "error", err)
+			stop()
+		}
+	}()
+
+	// PlanService on its own port; GRPC_ADDR moves it
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = defaultGRPCAddr
+	}
+	grpcServer := controllers.NewGRPCServer()
+	go func() {
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err == nil {
+			err = grpcServer.Serve(lis)
+		}
+		if err != nil {
+			slog.Error("gRPC server stopped", "error", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+
+	// Stop accepting connections and let in-flight requests finish, which
+	// includes bulk imports writing their last batch, then close clients.
+	// Everything has to be done within SHUTDOWN_TIMEOUT.
+	timeout := config.DurationFromEnv("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	slog.Info("Shutting down", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		slog.Error("In-flight requests did not finish", "error", err)
+	}
+	// Watch streams end when ctx is cancelled, so only unary calls and List
+	// are left to finish
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		slog.Error("In-flight gRPC calls did not finish")
+		grpcServer.Stop()
+	}
+	if bus != nil {
+		// Requests are done publishing, so handle what they left behind
+		bus.Close()
+		done := make(chan struct{})
+		go func() {
+			handlers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-shutdownCtx.Done():
+			slog.Error("Event handlers did not finish the queued events")
+		}
+	}
+	middleware.StopKeyRefresh()
+	controllers.CloseSearchClient()
+	if publisher != nil {
+		if err := publisher.Close(); err != nil {
+			slog.Error("Failed to close RabbitMQ connection", "error", err)
+		}
+	}
+	if err := config.RedisClient.Close(); err != nil {
+		slog.Error("Failed to close Redis client", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// runIndexer keeps the plans index up to date from queue until the bus is
+// closed and drained, doing in-process what the consumer does for RabbitMQ.
+func runIndexer(ctx context.Context, queue broker.EventSubscriber) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	defer transport.CloseIdleConnections()
+	es, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:       []string{"http://localhost:9200"},
+		Transport:       transport,
+		Instrumentation: elasticsearch.NewOpenTelemetryInstrumentation(otel.GetTracerProvider(), false),
+	})
+	if err != nil {
+		slog.Error("Failed to create the Elasticsearch client", "error", err)
+		return
+	}
+
+	ix := indexer.New(es)
+	for ctx.Err() == nil {
+		err := ix.Setup(ctx)
+		if err == nil {
+			break
+		}
+		slog.Warn("Elasticsearch unavailable, retrying", "in", indexerRetryDelay, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(indexerRetryDelay):
+		}
+	}
+
+	// Not bound to ctx: shutdown closes the bus and this drains it
+	slog.Info("Indexing plans in process")
+	if err := queue.Subscribe(context.Background(), ix.Handle); err != nil {
+		slog.Error("Indexer stopped", "error", err)
+	}
+}
+
+// runWebhooks schedules webhook deliveries for the events on queue until
+// the bus is closed and drained, and makes them until ctx is cancelled.
+// Deliveries scheduled after that are made once a dispatcher runs again.
+func runWebhooks(ctx context.Context, queue broker.EventSubscriber) {
+	dispatcher := webhooks.NewDispatcher()
+	retries := make(chan struct{})
+	go func() {
+		defer close(retries)
+		dispatcher.Run(ctx)
+	}()
+
+	slog.Info("Delivering webhooks in process")
+	if err := queue.Subscribe(context.Background(), dispatcher.Handle); err != nil {
+		slog.Error("Webhook dispatcher stopped", "error", err)
+	}
+	<-retries
 }
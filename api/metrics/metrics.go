@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// API metrics
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// ConditionalReads counts plan reads that sent If-None-Match, split by
+	// whether the ETag still matched (hit, 304) or not (miss).
+	ConditionalReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "plan_conditional_reads_total",
+		Help: "Plan reads with If-None-Match by result.",
+	}, []string{"result"})
+
+	RedisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "redis_command_duration_seconds",
+		Help:    "Redis command and pipeline latency.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command"})
+
+	RedisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redis_command_errors_total",
+		Help: "Redis commands that failed, not counting missing keys.",
+	}, []string{"command"})
+
+	Published = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_published_messages_total",
+		Help: "Messages published by destination (the RabbitMQ exchange, or memory for the in-process bus) and result.",
+	}, []string{"destination", "result"})
+
+	FeedSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "plan_feed_subscribers",
+		Help: "Clients connected to the plan change feed.",
+	})
+)
+
+// Consumer metrics
+var (
+	MessagesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_messages_processed_total",
+		Help: "Messages handled by the consumer by operation.",
+	}, []string{"operation"})
+
+	IndexErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_index_errors_total",
+		Help: "Elasticsearch requests that failed by action.",
+	}, []string{"action"})
+
+	// An event is discarded when the index already holds the plan at the
+	// event's sequence or later
+	EventsDiscarded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_events_discarded_total",
+		Help: "Events not applied because they were stale or duplicates, by reason.",
+	}, []string{"reason"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Webhook deliveries by result, counting each one once however many attempts it took.",
+	}, []string{"result"})
+
+	// IndexLag runs from the plan write in the API to the end of indexing
+	IndexLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "consumer_index_lag_seconds",
+		Help:    "Time from plan write to the plan being indexed.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"operation"})
+)
+
+// Handler serves the default registry.
+var Handler = adaptor.HTTPHandler(promhttp.Handler())
+
+// Middleware records the count and latency of every request under its route
+// pattern, so plan ids do not explode the label set. Errors are rendered
+// here so the recorded status is the one the client gets.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+
+	if err := c.Next(); err != nil {
+		if err := c.App().Config().ErrorHandler(c, err); err != nil {
+			return err
+		}
+	}
+
+	route := c.Route().Path
+	method := c.Method()
+	HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().StatusCode())).Inc()
+	HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	return nil
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// CurrentUser returns the subject and email of the caller authenticated by
+// AuthMiddleware, or empty strings if there is none.
+func CurrentUser(c *fiber.Ctx) (subject string, email string) {
+	claims, _ := c.Locals("user").(*jwt.MapClaims)
+	return userOf(claims)
+}
+
+type userKey struct{}
+
+// WithUser stores the claims of an authenticated caller in ctx, for code
+// that is shared with the gRPC service and only sees the context.
+func WithUser(ctx context.Context, claims *jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, userKey{}, claims)
+}
+
+// UserFromContext is CurrentUser for a context set up by WithUser.
+func UserFromContext(ctx context.Context) (subject string, email string) {
+	claims, _ := ctx.Value(userKey{}).(*jwt.MapClaims)
+	return userOf(claims)
+}
+
+func userOf(claims *jwt.MapClaims) (subject string, email string) {
+	if claims == nil {
+		return "", ""
+	}
+	subject, _ = (*claims)["sub"].(string)
+	email, _ = (*claims)["email"].(string)
+	return subject, email
+}
+
+// AdminMiddleware only lets through callers whose email is listed in the
+// comma separated ADMIN_EMAILS environment variable and verified by the
+// identity provider, since anyone can sign up with an unverified address.
+// It must run after AuthMiddleware.
+func AdminMiddleware(c *fiber.Ctx) error {
+	claims, _ := c.Locals("user").(*jwt.MapClaims)
+	if _, email := userOf(claims); email != "" && emailVerified(claims) {
+		for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+			if strings.EqualFold(strings.TrimSpace(admin), email) {
+				return c.Next()
+			}
+		}
+	}
+	return problem.Forbidden("Admin access required")
+}
+
+// emailVerified reports whether the email_verified claim is true.
+func emailVerified(claims *jwt.MapClaims) bool {
+	if claims == nil {
+		return false
+	}
+	verified, _ := (*claims)["email_verified"].(bool)
+	return verified
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	t.Setenv("ADMIN_EMAILS", "ops@example.com, admin@example.com")
+
+	tests := []struct {
+		name       string
+		claims     *jwt.MapClaims
+		wantStatus int
+	}{
+		{"verified admin", &jwt.MapClaims{"email": "Admin@example.com", "email_verified": true}, fiber.StatusOK},
+		{"unverified admin", &jwt.MapClaims{"email": "admin@example.com", "email_verified": false}, fiber.StatusForbidden},
+		{"admin without email_verified", &jwt.MapClaims{"email": "admin@example.com"}, fiber.StatusForbidden},
+		{"email_verified as a string", &jwt.MapClaims{"email": "admin@example.com", "email_verified": "true"}, fiber.StatusForbidden},
+		{"verified non-admin", &jwt.MapClaims{"email": "user@example.com", "email_verified": true}, fiber.StatusForbidden},
+		{"no user", nil, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: problem.Handler})
+			app.Get("/", func(c *fiber.Ctx) error {
+				if tt.claims != nil {
+					c.Locals("user", tt.claims)
+				}
+				return c.Next()
+			}, AdminMiddleware, func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,19 +1,13 @@
 package middleware
 
 import (
-	"crypto/rsa"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"math/big"
-	"net/http"
+	"log/slog"
 	"os"
 	"strings"
-	"sync"
-	"time"
 
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/joho/godotenv"
@@ -24,79 +18,27 @@ const (
 	googleIssuer   = "https://accounts.google.com"
 )
 
-var (
-	certsCache     googleCerts
-	certsCacheTime time.Time
-	cacheMutex     sync.Mutex
-)
-
-// Struct to hold Google's public keys
-type googleCerts struct {
-	Keys []struct {
-		Kid string `json:"kid"`
-		N   string `json:"n"`
-		E   string `json:"e"`
-	} `json:"keys"`
-}
-
-// Fetch Google’s public keys (cached for performance)
-func getGooglePublicKeys() (*googleCerts, error) {
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-
-	if time.Since(certsCacheTime) < time.Hour {
-		return &certsCache, nil
-	}
-
-	resp, err := http.Get(googleCertsURL)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	var certs googleCerts
-	if err := json.Unmarshal(body, &certs); err != nil {
-		return nil, err
-	}
-
-	certsCache = certs
-	certsCacheTime = time.Now()
-	return &certs, nil
-}
-
-// Convert Google's key format to *rsa.PublicKey
-func getPublicKey(kid string) (*rsa.PublicKey, error) {
-	certs, err := getGooglePublicKeys()
-	if err != nil {
-		return nil, err
-	}
-
-	for _, key := range certs.Keys {
-		if key.Kid == kid {
-			nBytes, _ := jwt.DecodeSegment(key.N)
-			eBytes, _ := jwt.DecodeSegment(key.E)
-
-			n := new(big.Int).SetBytes(nBytes)
-			e := int(new(big.Int).SetBytes(eBytes).Int64())
+// googleKeys caches Google's signing keys across requests.
+var googleKeys = NewJWKSCache(googleCertsURL)
 
-			pubKey := &rsa.PublicKey{N: n, E: e}
-			return pubKey, nil
-		}
-	}
-	return nil, errors.New("public key not found")
+// StopKeyRefresh ends the background refresh of Google's signing keys on
+// shutdown.
+func StopKeyRefresh() {
+	googleKeys.Stop()
 }
 
 // Verify Google JWT token
 func verifyGoogleToken(tokenString string) (*jwt.MapClaims, error) {
 	err := godotenv.Load(".env")
 	if err != nil {
-    	log.Print("error loading env")
-    }
-	var cliendID=os.Getenv("CLIENT_ID")
+		slog.Debug("No .env file loaded", "error", err)
+	}
+	var cliendID = os.Getenv("CLIENT_ID")
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
@@ -105,7 +47,7 @@ func verifyGoogleToken(tokenString string) (*jwt.MapClaims, error) {
 			return nil, errors.New("missing kid")
 		}
 
-		return getPublicKey(kid)
+		return googleKeys.Key(kid)
 	})
 
 	if err != nil {
@@ -131,21 +73,25 @@ func verifyGoogleToken(tokenString string) (*jwt.MapClaims, error) {
 func AuthMiddleware(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing Authorization header"})
+		return problem.Unauthorized("Missing Authorization header")
 	}
 
 	tokenParts := strings.Split(authHeader, " ")
 	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid Authorization format"})
+		return problem.Unauthorized("Invalid Authorization format")
 	}
 
 	token := tokenParts[1]
 	userClaims, err := verifyGoogleToken(token)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": fmt.Sprintf("Unauthorized: %v", err)})
+		// The reason stays in the server log, it only helps an attacker
+		slog.WarnContext(c.UserContext(), "Rejected token", "method", c.Method(), "path", c.Path(), "error", err)
+		return problem.Unauthorized("Invalid or expired token")
 	}
 
-	// Store user claims in Fiber's Locals (accessible in handlers)
+	// Store user claims in Fiber's Locals (accessible in handlers), and in
+	// the request context for code shared with the gRPC service
 	c.Locals("user", userClaims)
+	c.SetUserContext(WithUser(c.UserContext(), userClaims))
 	return c.Next()
 }
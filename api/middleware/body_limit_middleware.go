@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit reads the request body of every route but the streamed paths
+// into memory, answering 413 when it is larger than limit. The server
+// streams request bodies so that a streamed route, such as the bulk
+// import, can read a body larger than limit as it goes; the server itself
+// then enforces no limit, so this middleware has to run on every request.
+func BodyLimit(limit int, streamed ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if slices.Contains(streamed, c.Path()) {
+			return c.Next()
+		}
+		if c.Request().Header.ContentLength() > limit {
+			return tooLarge(limit)
+		}
+
+		// Bodies are only streamed when the server is set up to
+		stream := c.Context().RequestBodyStream()
+		if stream == nil {
+			return c.Next()
+		}
+		body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+		if err != nil {
+			return problem.BadRequest(problem.CodeClientError, fmt.Sprintf("Failed to read request body: %v", err))
+		}
+		if len(body) > limit {
+			return tooLarge(limit)
+		}
+		c.Request().SetBody(body)
+		return c.Next()
+	}
+}
+
+func tooLarge(limit int) *problem.Problem {
+	return problem.New(fiber.StatusRequestEntityTooLarge, problem.CodeRequestTooLarge,
+		fmt.Sprintf("Request body is larger than %d bytes", limit))
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBodyLimit(t *testing.T) {
+	app := fiber.New(fiber.Config{StreamRequestBody: true, ErrorHandler: problem.Handler})
+	app.Use(BodyLimit(8, "/stream"))
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	app.Post("/stream", func(c *fiber.Ctx) error {
+		return c.SendStream(c.Context().RequestBodyStream())
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"body within the limit", "/echo", "12345678", fiber.StatusOK},
+		{"body past the limit", "/echo", "123456789", fiber.StatusRequestEntityTooLarge},
+		{"streamed route has no limit", "/stream", strings.Repeat("x", 64*1024), fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, tt.path, strings.NewReader(tt.body)), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != fiber.StatusOK {
+				return
+			}
+			if data, _ := io.ReadAll(resp.Body); string(data) != tt.body {
+				t.Errorf("handler read %d bytes, want %d", len(data), len(tt.body))
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Health checks and reflection are open, like /healthz and the OpenAPI
+// spec.
+var publicGRPCServices = []string{"/grpc.health.v1.Health/", "/grpc.reflection."}
+
+// UnaryAuthInterceptor is AuthMiddleware for unary gRPC calls: the same
+// Google ID token, sent as "authorization: Bearer <token>" metadata.
+func UnaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticateGRPC(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamAuthInterceptor is UnaryAuthInterceptor for streaming calls.
+func StreamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticateGRPC(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func authenticateGRPC(ctx context.Context, method string) (context.Context, error) {
+	for _, prefix := range publicGRPCServices {
+		if strings.HasPrefix(method, prefix) {
+			return ctx, nil
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "Missing authorization metadata")
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || scheme != "Bearer" {
+		return nil, status.Error(codes.Unauthenticated, "Invalid authorization format")
+	}
+
+	userClaims, err := verifyGoogleToken(token)
+	if err != nil {
+		// The reason stays in the server log, it only helps an attacker
+		slog.WarnContext(ctx, "Rejected token", "method", method, "error", err)
+		return nil, status.Error(codes.Unauthenticated, "Invalid or expired token")
+	}
+	return WithUser(ctx, userClaims), nil
+}
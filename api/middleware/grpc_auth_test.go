@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthInterceptorPublicMethods(t *testing.T) {
+	tests := []struct {
+		method   string
+		metadata metadata.MD
+		wantCode codes.Code
+	}{
+		{"/grpc.health.v1.Health/Check", nil, codes.OK},
+		{"/grpc.health.v1.Health/Watch", nil, codes.OK},
+		{"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", nil, codes.OK},
+		{"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", nil, codes.OK},
+		{"/plans.v1.PlanService/Get", nil, codes.Unauthenticated},
+		{"/plans.v1.PlanService/Get", metadata.Pairs("authorization", "Basic dXNlcjpwYXNz"), codes.Unauthenticated},
+		// Only a prefix of the full method name opens it
+		{"/plans.v1.PlanService/grpc.health.v1.Health/Check", nil, codes.Unauthenticated},
+		{"/grpc.health.v2.Health/Check", nil, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.metadata != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.metadata)
+			}
+
+			called := false
+			_, err := UnaryAuthInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(context.Context, interface{}) (interface{}, error) {
+					called = true
+					return nil, nil
+				})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("unary code = %v, want %v", code, tt.wantCode)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("unary handler called = %v", called)
+			}
+
+			called = false
+			err = StreamAuthInterceptor(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tt.method},
+				func(interface{}, grpc.ServerStream) error {
+					called = true
+					return nil
+				})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("stream code = %v, want %v", code, tt.wantCode)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("stream handler called = %v", called)
+			}
+		})
+	}
+}
+
+// testServerStream is a grpc.ServerStream that only has a context.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
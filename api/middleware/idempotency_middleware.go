@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	idempotencyHeader     = "Idempotency-Key"
+	defaultIdempotencyTTL = 24 * time.Hour
+	idempotencyLockTTL    = time.Minute
+)
+
+// Only these response headers are stored and replayed.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+type idempotentResponse struct {
+	Fingerprint string            `json:"fingerprint"`
+	Pending     bool              `json:"pending,omitempty"`
+	Status      int               `json:"status,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+func idempotencyTTL() time.Duration {
+	return config.DurationFromEnv("IDEMPOTENCY_TTL", defaultIdempotencyTTL)
+}
+
+// IdempotencyMiddleware makes a request carrying an Idempotency-Key header
+// safe to retry. The first response for a caller and key is stored in
+// Redis and replayed for later requests with the same key; reusing a key
+// for a different request is rejected with 422. It must run after
+// AuthMiddleware so keys are scoped to the caller.
+func IdempotencyMiddleware(c *fiber.Ctx) error {
+	key := c.Get(idempotencyHeader)
+	if key == "" {
+		return c.Next()
+	}
+
+	ctx := c.UserContext()
+	subject, email := CurrentUser(c)
+	if subject == "" {
+		subject = email
+	}
+	redisKey := fmt.Sprintf("idempotency:%s:%s", subject, key)
+
+	sum := sha256.New()
+	sum.Write([]byte(c.Method()))
+	sum.Write([]byte(c.Path()))
+	sum.Write(c.Body())
+	fingerprint := fmt.Sprintf("%x", sum.Sum(nil))
+
+	// Claim the key with a short-lived placeholder so two concurrent
+	// retries cannot both run the handler
+	placeholder, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint, Pending: true})
+	claimed, err := config.RedisClient.SetNX(ctx, redisKey, placeholder, idempotencyLockTTL).Result()
+	if err != nil {
+		return problem.Internal("Failed to check idempotency key", err)
+	}
+
+	if !claimed {
+		val, err := config.RedisClient.Get(ctx, redisKey).Result()
+		if err == redis.Nil {
+			return problem.Conflict(problem.CodeIdempotencyInProgress, "Request with this Idempotency-Key is being retried, try again")
+		} else if err != nil {
+			return problem.Internal("Failed to check idempotency key", err)
+		}
+
+		var stored idempotentResponse
+		if err := json.Unmarshal([]byte(val), &stored); err != nil {
+			return problem.Internal("Corrupt idempotency record", err)
+		}
+		if stored.Fingerprint != fingerprint {
+			return problem.New(fiber.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+		}
+		if stored.Pending {
+			return problem.Conflict(problem.CodeIdempotencyInProgress, "Request with this Idempotency-Key is still in progress")
+		}
+
+		for name, value := range stored.Headers {
+			c.Set(name, value)
+		}
+		c.Set("Idempotent-Replayed", "true")
+		return c.Status(stored.Status).Send(stored.Body)
+	}
+
+	// Handlers report failures as errors; render them here so client
+	// errors are stored and replayed like any other response
+	if err := c.Next(); err != nil {
+		if err := c.App().Config().ErrorHandler(c, err); err != nil {
+			config.RedisClient.Del(ctx, redisKey)
+			return err
+		}
+	}
+
+	// Server errors are not remembered so the client can retry them
+	status := c.Response().StatusCode()
+	if status >= fiber.StatusInternalServerError {
+		config.RedisClient.Del(ctx, redisKey)
+		return nil
+	}
+
+	record := idempotentResponse{
+		Fingerprint: fingerprint,
+		Status:      status,
+		Headers:     make(map[string]string),
+		Body:        append([]byte(nil), c.Response().Body()...),
+	}
+	for _, name := range replayedHeaders {
+		if value := c.GetRespHeader(name); value != "" {
+			record.Headers[name] = value
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = config.RedisClient.Set(ctx, redisKey, data, idempotencyTTL()).Err()
+	}
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "Failed to store idempotent response", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultJWKSTTL         = time.Hour
+	minJWKSTTL             = time.Minute
+	defaultKidMissInterval = 30 * time.Second
+	jwksRetryInterval      = 30 * time.Second
+)
+
+var errKeyNotFound = errors.New("public key not found")
+
+// jsonWebKey is a single entry of a JWKS document (RFC 7517). Only the
+// members needed for RSA and EC signature verification are decoded.
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// JWKSCache keeps the public keys published at a JWKS endpoint. Keys are
+// cached for the max-age advertised by the endpoint, refreshed in the
+// background before they expire, and refetched (rate limited) when a token
+// references a kid we have not seen yet, so key rotation is picked up
+// without waiting for the cache to expire.
+type JWKSCache struct {
+	URL    string
+	Client *http.Client
+
+	// KidMissInterval is the minimum time between refetches triggered by
+	// a request, whether for an unknown kid or an expired cache.
+	KidMissInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]interface{}
+	expiresAt time.Time
+	lastFetch time.Time
+
+	group     singleflight.Group
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+}
+
+func NewJWKSCache(url string) *JWKSCache {
+	return &JWKSCache{
+		URL:             url,
+		Client:          &http.Client{Timeout: 10 * time.Second},
+		KidMissInterval: defaultKidMissInterval,
+		stop:            make(chan struct{}),
+	}
+}
+
+// Key returns the public key (*rsa.PublicKey or *ecdsa.PublicKey) for kid.
+func (j *JWKSCache) Key(kid string) (interface{}, error) {
+	j.startOnce.Do(func() { go j.refreshLoop() })
+
+	j.mu.RLock()
+	key, found := j.keys[kid]
+	expired := time.Now().After(j.expiresAt)
+	sinceFetch := time.Since(j.lastFetch)
+	j.mu.RUnlock()
+
+	if found && !expired {
+		return key, nil
+	}
+
+	// Only go back to the endpoint if we have not just done so. This
+	// stops garbage kids from hammering it, and while it is down an
+	// expired key is served stale instead of every request waiting on
+	// another failing fetch.
+	if sinceFetch < j.KidMissInterval {
+		if found {
+			return key, nil
+		}
+		return nil, errKeyNotFound
+	}
+
+	if err := j.refresh(); err != nil {
+		// Serve a stale key rather than failing every request while
+		// the endpoint is unavailable.
+		if found {
+			slog.Warn("JWKS refresh failed, using cached key", "kid", kid, "error", err)
+			return key, nil
+		}
+		return nil, err
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errKeyNotFound
+}
+
+// Stop ends the background refresh goroutine.
+func (j *JWKSCache) Stop() {
+	j.stopOnce.Do(func() { close(j.stop) })
+}
+
+// refresh fetches the key set once, collapsing concurrent callers into a
+// single request.
+func (j *JWKSCache) refresh() error {
+	_, err, _ := j.group.Do("jwks", func() (interface{}, error) {
+		keys, ttl, err := j.fetch()
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.lastFetch = time.Now()
+		if err != nil {
+			return nil, err
+		}
+		j.keys = keys
+		j.expiresAt = j.lastFetch.Add(ttl)
+		return nil, nil
+	})
+	return err
+}
+
+func (j *JWKSCache) refreshLoop() {
+	for {
+		select {
+		case <-j.stop:
+			return
+		default:
+		}
+
+		j.mu.RLock()
+		fetched, expiresAt := j.lastFetch, j.expiresAt
+		j.mu.RUnlock()
+
+		// Refresh once 90% of the TTL has elapsed so requests never
+		// block on the endpoint.
+		wait := time.Until(fetched.Add(expiresAt.Sub(fetched) * 9 / 10))
+		if expiresAt.IsZero() || wait <= 0 {
+			err := j.refresh()
+			if err == nil {
+				continue
+			}
+			slog.Warn("Background JWKS refresh failed", "error", err)
+			wait = jwksRetryInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-j.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (j *JWKSCache) fetch() (map[string]interface{}, time.Duration, error) {
+	resp, err := j.Client.Get(j.URL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	var set jsonWebKeySet
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			slog.Warn("Skipping JWKS key", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, 0, errors.New("JWKS contains no usable keys")
+	}
+
+	return keys, cacheTTL(resp.Header), nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		xBytes, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		yBytes, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(xBytes),
+			Y:     new(big.Int).SetBytes(yBytes),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// cacheTTL derives how long a JWKS response may be cached from its
+// Cache-Control max-age (less any Age), falling back to an hour.
+func cacheTTL(h http.Header) time.Duration {
+	ttl := defaultJWKSTTL
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		if secs, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+			ttl = time.Duration(secs) * time.Second
+		}
+	}
+	if age, err := strconv.Atoi(h.Get("Age")); err == nil {
+		ttl -= time.Duration(age) * time.Second
+	}
+	if ttl < minJWKSTTL {
+		ttl = minJWKSTTL
+	}
+	return ttl
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves a JWKS document for the keys in kids and counts the
+// requests it receives. Setting fail makes it answer 503.
+type jwksServer struct {
+	*httptest.Server
+	hits atomic.Int32
+	fail atomic.Bool
+	kids atomic.Value // []string
+}
+
+func newJWKSServer(t *testing.T, cacheControl string, kids ...string) *jwksServer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &jwksServer{}
+	s.kids.Store(kids)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		if s.fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var set jsonWebKeySet
+		for _, kid := range s.kids.Load().([]string) {
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kid: kid,
+				Kty: "EC",
+				Use: "sig",
+				Crv: "P-256",
+				X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+				Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+			})
+		}
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newTestCache returns a cache for url with the background refresh stopped,
+// so every fetch comes from Key and request counts are deterministic.
+func newTestCache(url string) *JWKSCache {
+	j := NewJWKSCache(url)
+	j.Stop()
+	return j
+}
+
+// age pretends the last fetch happened d ago, expiring the cache if the
+// TTL has passed by then.
+func (j *JWKSCache) age(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastFetch = j.lastFetch.Add(-d)
+	j.expiresAt = j.expiresAt.Add(-d)
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		age          string
+		want         time.Duration
+	}{
+		{"no header", "", "", defaultJWKSTTL},
+		{"max-age", "max-age=600", "", 600 * time.Second},
+		{"max-age among directives", "public, max-age=300, must-revalidate", "", 300 * time.Second},
+		{"max-age minus age", "max-age=600", "120", 480 * time.Second},
+		{"clamped to minimum", "max-age=10", "", minJWKSTTL},
+		{"age past max-age", "max-age=600", "900", minJWKSTTL},
+		{"invalid max-age", "max-age=soon", "", defaultJWKSTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.cacheControl != "" {
+				h.Set("Cache-Control", tt.cacheControl)
+			}
+			if tt.age != "" {
+				h.Set("Age", tt.age)
+			}
+			if got := cacheTTL(h); got != tt.want {
+				t.Errorf("cacheTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKSCacheServesFromCache(t *testing.T) {
+	srv := newJWKSServer(t, "max-age=600", "a")
+	j := newTestCache(srv.URL)
+
+	for i := 0; i < 3; i++ {
+		key, err := j.Key("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := key.(*ecdsa.PublicKey); !ok {
+			t.Fatalf("Key() = %T, want *ecdsa.PublicKey", key)
+		}
+	}
+	if got := srv.hits.Load(); got != 1 {
+		t.Errorf("endpoint hit %d times, want 1", got)
+	}
+
+	// Once max-age has passed the next request refetches
+	j.age(601 * time.Second)
+	if _, err := j.Key("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.hits.Load(); got != 2 {
+		t.Errorf("endpoint hit %d times after expiry, want 2", got)
+	}
+}
+
+func TestJWKSCacheKidMissIsRateLimited(t *testing.T) {
+	srv := newJWKSServer(t, "max-age=600", "a")
+	j := newTestCache(srv.URL)
+
+	if _, err := j.Key("a"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := j.Key("b"); err != errKeyNotFound {
+			t.Fatalf("Key(unknown) error = %v, want errKeyNotFound", err)
+		}
+	}
+	if got := srv.hits.Load(); got != 1 {
+		t.Errorf("endpoint hit %d times, want 1", got)
+	}
+
+	// After the interval an unknown kid refetches and picks up rotation
+	srv.kids.Store([]string{"a", "b"})
+	j.age(j.KidMissInterval)
+	if _, err := j.Key("b"); err != nil {
+		t.Fatalf("Key(rotated) error = %v", err)
+	}
+	if got := srv.hits.Load(); got != 2 {
+		t.Errorf("endpoint hit %d times after rotation, want 2", got)
+	}
+}
+
+func TestJWKSCacheServesStaleKeyWhileEndpointFails(t *testing.T) {
+	srv := newJWKSServer(t, "max-age=60", "a")
+	j := newTestCache(srv.URL)
+
+	if _, err := j.Key("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.fail.Store(true)
+	j.age(2 * time.Minute)
+
+	// The first request after expiry tries the endpoint and falls back
+	if _, err := j.Key("a"); err != nil {
+		t.Fatalf("Key() error = %v, want stale key", err)
+	}
+	if got := srv.hits.Load(); got != 2 {
+		t.Fatalf("endpoint hit %d times, want 2", got)
+	}
+
+	// Later requests get the stale key without waiting on the endpoint
+	for i := 0; i < 5; i++ {
+		if _, err := j.Key("a"); err != nil {
+			t.Fatalf("Key() error = %v, want stale key", err)
+		}
+	}
+	if got := srv.hits.Load(); got != 2 {
+		t.Errorf("endpoint hit %d times during outage, want 2", got)
+	}
+
+	// Unknown kids still fail fast
+	if _, err := j.Key("b"); err != errKeyNotFound {
+		t.Errorf("Key(unknown) error = %v, want errKeyNotFound", err)
+	}
+
+	// Once the interval passes it tries again and recovers
+	srv.fail.Store(false)
+	j.age(j.KidMissInterval)
+	if _, err := j.Key("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.hits.Load(); got != 3 {
+		t.Errorf("endpoint hit %d times after recovery, want 3", got)
+	}
+}
+
+func TestJWKSCacheFailsWithoutCachedKey(t *testing.T) {
+	srv := newJWKSServer(t, "", "a")
+	srv.fail.Store(true)
+	j := newTestCache(srv.URL)
+
+	if _, err := j.Key("a"); err == nil || err == errKeyNotFound {
+		t.Errorf("Key() error = %v, want fetch error", err)
+	}
+}
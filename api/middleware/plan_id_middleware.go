@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ValidPlanId reports whether id can name a plan. Redis keys for etags,
+// versions and the trash are built by joining the id with ':', so an id
+// containing one could reach those keys instead of a live plan.
+func ValidPlanId(id string) bool {
+	return id != "" && !strings.Contains(id, ":")
+}
+
+// PlanIdMiddleware answers 404 for a :id route parameter that can never
+// name a plan, such as "trash:<objectId>".
+func PlanIdMiddleware(c *fiber.Ctx) error {
+	if id := c.Params("id"); !ValidPlanId(id) {
+		return problem.NotFound(problem.CodePlanNotFound, "Plan not found").WithObject(id)
+	}
+	return c.Next()
+}
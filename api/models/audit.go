@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEntry struct {
+	ID         string          `json:"id,omitempty"`
+	Subject    string          `json:"subject"`
+	Email      string          `json:"email,omitempty"`
+	Timestamp  string          `json:"timestamp"`
+	Operation  string          `json:"operation"`
+	ObjectId   string          `json:"objectId"`
+	BeforeETag string          `json:"beforeETag,omitempty"`
+	AfterETag  string          `json:"afterETag,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+}
+
+// AuditQuery filters the global audit stream. A zero From or To leaves
+// that end of the range open.
+type AuditQuery struct {
+	User  string
+	From  time.Time
+	To    time.Time
+	Count int64
+}
@@ -1,9 +1,44 @@
 package models
 
+import "time"
 
+// PlanMessage is the event published for every write to a plan. Sequence
+// grows with each write to the same plan, which lets the consumer drop
+// events that are stale or delivered twice.
 type PlanMessage struct {
-	Operation string `json:"operation"`
-	Plan      Plan   `json:"plan"`
+	EventId       string    `json:"eventId"`
+	SchemaVersion int       `json:"schemaVersion"`
+	OccurredAt    time.Time `json:"occurredAt"`
+	Actor         string    `json:"actor,omitempty"`
+	ETag          string    `json:"etag,omitempty"`
+	Sequence      int64     `json:"sequence"`
+	Operation     string    `json:"operation"`
+	Plan          Plan      `json:"plan"`
+}
+
+// Event types, which are also the routing keys plan events are published
+// with and the events webhooks subscribe to.
+const (
+	EventPlanCreated = "plan.created"
+	EventPlanPatched = "plan.patched"
+	EventPlanDeleted = "plan.deleted"
+)
+
+// EventID, EventType and EventTime describe the message to the broker.
+func (m PlanMessage) EventID() string      { return m.EventId }
+func (m PlanMessage) EventTime() time.Time { return m.OccurredAt }
+
+// EventType names what happened to the plan, e.g. plan.created.
+func (m PlanMessage) EventType() string {
+	switch m.Operation {
+	case "create":
+		return EventPlanCreated
+	case "patch":
+		return EventPlanPatched
+	case "delete":
+		return EventPlanDeleted
+	}
+	return "plan." + m.Operation
 }
 
 type SearchPlanRequest struct {
@@ -12,46 +47,116 @@ type SearchPlanRequest struct {
 }
 
 type Plan struct {
-	PlanCostShares     *PlanCostShares     `json:"planCostShares" binding:"required"`
-	LinkedPlanServices []LinkedPlanService `json:"linkedPlanServices" binding:"required"`
-	CreationDate       string              `json:"creationDate" binding:"required"`
-	ObjectId           string              `json:"objectId" binding:"required"`
-	ObjectType         string              `json:"objectType" binding:"required"`
-	Org                string              `json:"_org" binding:"required"`
+	PlanCostShares     *PlanCostShares        `json:"planCostShares" binding:"required"`
+	LinkedPlanServices []LinkedPlanService    `json:"linkedPlanServices" binding:"required"`
+	CreationDate       string                 `json:"creationDate" binding:"required"`
+	ObjectId           string                 `json:"objectId" binding:"required"`
+	ObjectType         string                 `json:"objectType" binding:"required"`
+	Org                string                 `json:"_org" binding:"required"`
 	PlanJoin           map[string]interface{} `json:"plan_join,omitempty"`
 }
 
 type PlanCostShares struct {
-	Deductible int    `json:"deductible" binding:"required"`
-	Copay      int    `json:"copay" binding:"required"`
-	ObjectId   string `json:"objectId" binding:"required"`
-	ObjectType string `json:"objectType" binding:"required"`
-	Org        string `json:"_org" binding:"required"`
-	PlanJoin           map[string]interface{} `json:"plan_join,omitempty"`
+	Deductible int                    `json:"deductible" binding:"required"`
+	Copay      int                    `json:"copay" binding:"required"`
+	ObjectId   string                 `json:"objectId" binding:"required"`
+	ObjectType string                 `json:"objectType" binding:"required"`
+	Org        string                 `json:"_org" binding:"required"`
+	PlanJoin   map[string]interface{} `json:"plan_join,omitempty"`
 }
 
 type LinkedService struct {
-	Name       string `json:"name" binding:"required"`
-	ObjectId   string `json:"objectId" binding:"required"`
-	ObjectType string `json:"objectType" binding:"required"`
-	Org        string `json:"_org" binding:"required"`
-	PlanJoin           map[string]interface{} `json:"plan_join,omitempty"`
+	Name       string                 `json:"name" binding:"required"`
+	ObjectId   string                 `json:"objectId" binding:"required"`
+	ObjectType string                 `json:"objectType" binding:"required"`
+	Org        string                 `json:"_org" binding:"required"`
+	PlanJoin   map[string]interface{} `json:"plan_join,omitempty"`
 }
 
 type PlanServiceCostShares struct {
-	Deductible int    `json:"deductible" binding:"required"`
-	Copay      int    `json:"copay" binding:"required"`
-	ObjectId   string `json:"objectId" binding:"required"`
-	ObjectType string `json:"objectType" binding:"required"`
-	Org        string `json:"_org" binding:"required"`
-	PlanJoin           map[string]interface{} `json:"plan_join,omitempty"`
+	Deductible int                    `json:"deductible" binding:"required"`
+	Copay      int                    `json:"copay" binding:"required"`
+	ObjectId   string                 `json:"objectId" binding:"required"`
+	ObjectType string                 `json:"objectType" binding:"required"`
+	Org        string                 `json:"_org" binding:"required"`
+	PlanJoin   map[string]interface{} `json:"plan_join,omitempty"`
 }
 
 type LinkedPlanService struct {
-	LinkedService         LinkedService        `json:"linkedService" binding:"required"`
-	PlanServiceCostShares PlanServiceCostShares `json:"planserviceCostShares" binding:"required"`
-	ObjectId              string               `json:"objectId" binding:"required"`
-	ObjectType            string               `json:"objectType" binding:"required"`
-	Org                   string               `json:"_org" binding:"required"`
-	PlanJoin           map[string]interface{} `json:"plan_join,omitempty"`
+	LinkedService         LinkedService          `json:"linkedService" binding:"required"`
+	PlanServiceCostShares PlanServiceCostShares  `json:"planserviceCostShares" binding:"required"`
+	ObjectId              string                 `json:"objectId" binding:"required"`
+	ObjectType            string                 `json:"objectType" binding:"required"`
+	Org                   string                 `json:"_org" binding:"required"`
+	PlanJoin              map[string]interface{} `json:"plan_join,omitempty"`
+}
+
+type PlanVersion struct {
+	Version   int64  `json:"version"`
+	ETag      string `json:"etag"`
+	Timestamp string `json:"timestamp"`
+	Author    string `json:"author,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+	Plan      *Plan  `json:"plan,omitempty"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type LinkedPlanServiceChange struct {
+	ObjectId  string        `json:"objectId"`
+	Name      string        `json:"name"`
+	MatchedBy string        `json:"matchedBy"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+type PlanDiff struct {
+	Left                  string                    `json:"left"`
+	Right                 string                    `json:"right"`
+	Plan                  []FieldChange             `json:"plan"`
+	PlanCostShares        []FieldChange             `json:"planCostShares"`
+	LinkedServicesAdded   []LinkedPlanService       `json:"linkedServicesAdded"`
+	LinkedServicesRemoved []LinkedPlanService       `json:"linkedServicesRemoved"`
+	LinkedServicesChanged []LinkedPlanServiceChange `json:"linkedServicesChanged"`
+}
+
+type TrashedPlan struct {
+	ObjectId  string `json:"objectId"`
+	DeletedAt string `json:"deletedAt"`
+	DeletedBy string `json:"deletedBy,omitempty"`
+	PurgeAt   string `json:"purgeAt"`
+	Plan      *Plan  `json:"plan,omitempty"`
+}
+
+type BulkResult struct {
+	Line     int        `json:"line"`
+	ObjectId string     `json:"objectId,omitempty"`
+	Status   string     `json:"status"`
+	ETag     string     `json:"etag,omitempty"`
+	Field    string     `json:"field,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Errors   []RowError `json:"errors,omitempty"`
+	Diff     *PlanDiff  `json:"diff,omitempty"`
+}
+
+// RowError is one invalid cell of a CSV import, reported under the plan it
+// belongs to.
+type RowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type BulkReport struct {
+	Mode      string       `json:"mode"`
+	DryRun    bool         `json:"dryRun"`
+	Total     int          `json:"total"`
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import "encoding/json"
+
+// Webhook is a subscription to plan events. Events filters by event type
+// and Org by the plan's _org; empty means every event or org. The secret
+// signs every delivery and is only returned when the webhook is created.
+type Webhook struct {
+	Id        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events,omitempty"`
+	Org       string   `json:"_org,omitempty"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"createdAt"`
+	CreatedBy string   `json:"createdBy,omitempty"`
+	UpdatedAt string   `json:"updatedAt,omitempty"`
+}
+
+// WebhookDelivery records one attempt to deliver an event to a webhook.
+// Attempts counts the attempts made so far, and NextAttemptAt is set when
+// a failed attempt is to be retried.
+type WebhookDelivery struct {
+	ID            string          `json:"id,omitempty"`
+	WebhookId     string          `json:"webhookId"`
+	EventId       string          `json:"eventId"`
+	EventType     string          `json:"eventType"`
+	ObjectId      string          `json:"objectId"`
+	Timestamp     string          `json:"timestamp"`
+	Attempts      int             `json:"attempts"`
+	Succeeded     bool            `json:"succeeded"`
+	StatusCode    int             `json:"statusCode,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	NextAttemptAt string          `json:"nextAttemptAt,omitempty"`
+	Redelivery    bool            `json:"redelivery,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
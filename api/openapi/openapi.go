@@ -0,0 +1,200 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openapi.json is generated from the registered routes and the models and
+// checked in; the test in this package fails when it is out of date.
+//
+//go:embed openapi.json
+var specJSON []byte
+
+//go:embed docs.html
+var docsHTML []byte
+
+// The docs page loads nothing from outside the binary: swagger-ui is
+// vendored under swagger-ui/ (version in swagger-ui/VERSION) and docs.js
+// starts it, so the page works offline and under a script-src 'self' CSP.
+//
+//go:embed docs.js swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var docsFS embed.FS
+
+var docsAssets = map[string]string{
+	"docs.js":              "docs.js",
+	"swagger-ui.css":       "swagger-ui/swagger-ui.css",
+	"swagger-ui-bundle.js": "swagger-ui/swagger-ui-bundle.js",
+}
+
+var pathParam = regexp.MustCompile(`/:(\w+)`)
+
+func Spec(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(specJSON)
+}
+
+func Docs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(docsHTML)
+}
+
+// DocsAsset serves the scripts and styles of the docs page.
+func DocsAsset(c *fiber.Ctx) error {
+	name, ok := docsAssets[c.Params("file")]
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	data, err := docsFS.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	c.Type(path.Ext(name))
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return c.Send(data)
+}
+
+// Path converts a Fiber route path into its OpenAPI form.
+func Path(route string) string {
+	route = strings.ReplaceAll(route, `\:`, ":")
+	return pathParam.ReplaceAllString(route, "/{$1}")
+}
+
+// Generate builds the OpenAPI document for a set of routes. Every route must
+// have an entry in operations.
+func Generate(routes []fiber.Route) ([]byte, error) {
+	b := newSchemaBuilder()
+	paths := make(map[string]map[string]interface{})
+	var undocumented []string
+
+	for _, route := range routes {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		path := Path(route.Path)
+		key := route.Method + " " + path
+		op, ok := operations[key]
+		if !ok {
+			undocumented = append(undocumented, key)
+			continue
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = op.build(b)
+	}
+
+	if len(undocumented) > 0 {
+		sort.Strings(undocumented)
+		return nil, fmt.Errorf("routes missing from openapi operations: %s", strings.Join(undocumented, ", "))
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "Healthcare Plan Management API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+		},
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func (op operation) build(b *schemaBuilder) map[string]interface{} {
+	out := map[string]interface{}{
+		"summary": op.Summary,
+		"tags":    []string{op.Tag},
+	}
+	if op.Public {
+		out["security"] = []interface{}{}
+	}
+
+	if len(op.Params) > 0 {
+		params := make([]interface{}, 0, len(op.Params))
+		for _, p := range op.Params {
+			param := map[string]interface{}{
+				"name":   p.Name,
+				"in":     p.In,
+				"schema": map[string]interface{}{"type": p.Type},
+			}
+			if p.Required {
+				param["required"] = true
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+		out["parameters"] = params
+	}
+
+	if op.Body != nil || len(op.BodyTypes) > 0 {
+		content := make(map[string]interface{})
+		if op.Body != nil {
+			content[fiber.MIMEApplicationJSON] = map[string]interface{}{"schema": b.ref(op.Body)}
+		}
+		for _, contentType := range op.BodyTypes {
+			content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		out["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	// Every authenticated route can reject the bearer token
+	all := op.Responses
+	if !op.Public {
+		all = make(map[int]response, len(op.Responses)+1)
+		all[fiber.StatusUnauthorized] = errorResponse("Missing or invalid bearer token")
+		for status, r := range op.Responses {
+			all[status] = r
+		}
+	}
+
+	responses := make(map[string]interface{})
+	for status, r := range all {
+		resp := map[string]interface{}{"description": r.Description}
+		switch {
+		case r.Body != nil:
+			schema := b.ref(r.Body)
+			if r.Array {
+				schema = map[string]interface{}{"type": "array", "items": schema}
+			}
+			contentType := r.ContentType
+			if contentType == "" {
+				contentType = fiber.MIMEApplicationJSON
+			}
+			resp["content"] = map[string]interface{}{contentType: map[string]interface{}{"schema": schema}}
+		case r.ContentType != "":
+			resp["content"] = map[string]interface{}{r.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+		}
+		responses[strconv.Itoa(status)] = resp
+	}
+	out["responses"] = responses
+
+	return out
+}
@@ -0,0 +1,41 @@
+package openapi_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/openapi"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/routes"
+	"github.com/gofiber/fiber/v2"
+)
+
+var update = flag.Bool("update", false, "rewrite openapi.json from the current routes and models")
+
+// TestSpecUpToDate fails when a route or model field changes without
+// openapi.json being regenerated with: go test ./openapi -update
+func TestSpecUpToDate(t *testing.T) {
+	app := fiber.New()
+	routes.SetupRoutes(app)
+
+	got, err := openapi.Generate(app.GetRoutes(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := os.WriteFile("openapi.json", got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile("openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("openapi.json is out of date, regenerate it with: go test ./openapi -update")
+	}
+}
@@ -0,0 +1,410 @@
+package openapi
+
+import (
+	"github.com/dumbresi/Healthcare-Plan-Management/api/health"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/problem"
+)
+
+type param struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+type response struct {
+	Description string
+	Body        interface{}
+	Array       bool
+	ContentType string
+}
+
+type operation struct {
+	Summary   string
+	Tag       string
+	Public    bool
+	Params    []param
+	Body      interface{}
+	BodyTypes []string
+	Responses map[int]response
+}
+
+// message is the shape of the small acknowledgement bodies returned by
+// create and delete.
+type message struct {
+	Message    string `json:"message"`
+	ObjectId   string `json:"objectId"`
+	PurgeAfter string `json:"purgeAfter,omitempty"`
+}
+
+// graphqlRequest and graphqlResponse are the GraphQL over HTTP envelopes.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphqlResponse struct {
+	Data   map[string]interface{}   `json:"data,omitempty"`
+	Errors []map[string]interface{} `json:"errors,omitempty"`
+}
+
+var (
+	idParam      = param{Name: "id", In: "path", Type: "string", Required: true, Description: "Plan objectId"}
+	versionParam = param{Name: "n", In: "path", Type: "integer", Required: true, Description: "Version number, starting at 1"}
+	ifMatch      = param{Name: "If-Match", In: "header", Type: "string", Description: "ETag the client last saw"}
+	ifMatchReq   = param{Name: "If-Match", In: "header", Type: "string", Required: true, Description: "ETag the client last saw"}
+	webhookParam = param{Name: "id", In: "path", Type: "string", Required: true, Description: "Webhook id"}
+	idempotency  = param{Name: "Idempotency-Key", In: "header", Type: "string", Description: "Makes the request safe to retry"}
+)
+
+// errorResponse documents a problem+json error response.
+func errorResponse(description string) response {
+	return response{Description: description, Body: problem.Problem{}, ContentType: problem.ContentType}
+}
+
+// operations documents every route registered by routes.SetupRoutes, keyed
+// by method and OpenAPI path. Generate fails for routes missing from here.
+var operations = map[string]operation{
+	"POST /api/v1/plans": {
+		Summary: "Create a plan",
+		Tag:     "plans",
+		Params: []param{
+			idempotency,
+			{Name: "If-None-Match", In: "header", Type: "string", Description: "Send * to get 412 instead of 409 when the plan exists"},
+		},
+		Body: models.Plan{},
+		Responses: map[int]response{
+			201: {Description: "Plan created", Body: message{}},
+			400: errorResponse("Invalid or incomplete plan"),
+			409: errorResponse("Plan already exists"),
+			412: errorResponse("Plan already exists and If-None-Match: * was sent"),
+			422: errorResponse("Idempotency-Key reused for a different request"),
+		},
+	},
+	"GET /api/v1/plans": {
+		Summary: "List all plans",
+		Tag:     "plans",
+		Responses: map[int]response{
+			200: {Description: "All live plans", Body: models.Plan{}, Array: true},
+		},
+	},
+	"POST /api/v1/plans:bulk": {
+		Summary: "Import plans from NDJSON or CSV",
+		Tag:     "bulk",
+		Params: []param{
+			{Name: "mode", In: "query", Type: "string", Description: "create (default) or upsert"},
+			{Name: "dryRun", In: "query", Type: "boolean", Description: "Report what would change without writing"},
+		},
+		BodyTypes: []string{"application/x-ndjson", "text/csv"},
+		Responses: map[int]response{
+			200: {Description: "Per line import report", Body: models.BulkReport{}},
+			400: errorResponse("Invalid mode"),
+			413: errorResponse("Body larger than the configured limit"),
+		},
+	},
+	"GET /api/v1/plans:export": {
+		Summary: "Export all plans",
+		Tag:     "bulk",
+		Params: []param{
+			{Name: "format", In: "query", Type: "string", Description: "ndjson (default) or csv"},
+		},
+		Responses: map[int]response{
+			200: {Description: "One plan per line, or one linked service per CSV row", ContentType: "application/x-ndjson"},
+		},
+	},
+	"GET /api/v1/plans/trash": {
+		Summary: "List deleted plans awaiting purge",
+		Tag:     "trash",
+		Responses: map[int]response{
+			200: {Description: "Plans in the trash", Body: models.TrashedPlan{}, Array: true},
+		},
+	},
+	"GET /api/v1/plans/diff": {
+		Summary: "Compare two plans",
+		Tag:     "history",
+		Params: []param{
+			{Name: "left", In: "query", Type: "string", Required: true, Description: "objectId of the first plan"},
+			{Name: "right", In: "query", Type: "string", Required: true, Description: "objectId of the second plan"},
+		},
+		Responses: map[int]response{
+			200: {Description: "Semantic diff", Body: models.PlanDiff{}},
+			400: errorResponse("Missing plan id"),
+			404: errorResponse("Plan not found"),
+		},
+	},
+	"GET /api/v1/plans/events": {
+		Summary: "Stream plan changes as Server-Sent Events",
+		Tag:     "plans",
+		Params: []param{
+			{Name: "Last-Event-ID", In: "header", Type: "string", Description: "Resume after this event; a reset event is sent when it is no longer in the feed"},
+			{Name: "objectId", In: "query", Type: "string", Description: "Only these plans, repeated or comma separated"},
+			{Name: "org", In: "query", Type: "string", Description: "Only plans of these orgs, repeated or comma separated"},
+		},
+		Responses: map[int]response{
+			200: {Description: "One event per plan change, named plan.created, plan.patched or plan.deleted, carrying the event envelope", ContentType: "text/event-stream"},
+			400: errorResponse("Invalid Last-Event-ID"),
+		},
+	},
+	"GET /api/v1/plans/{id}": {
+		Summary: "Get a plan",
+		Tag:     "plans",
+		Params: []param{
+			idParam,
+			{Name: "If-None-Match", In: "header", Type: "string", Description: "Returns 304 if the ETag still matches"},
+			{Name: "asOf", In: "query", Type: "string", Description: "RFC 3339 timestamp for a point-in-time read"},
+			{Name: "fields", In: "query", Type: "string", Description: "Comma separated fields to return, e.g. objectId,planCostShares.copay"},
+			{Name: "expand", In: "query", Type: "string", Description: "Comma separated embedded objects to inline, e.g. linkedPlanServices; others become {objectId, objectType} references"},
+			{Name: "depth", In: "query", Type: "integer", Description: "Levels of embedded objects to inline, 0 for references only"},
+		},
+		Responses: map[int]response{
+			200: {Description: "The plan, shaped by fields, expand and depth. The ETag is that of the full plan.", Body: models.Plan{}},
+			304: {Description: "Not modified"},
+			400: errorResponse("Unknown field or invalid depth"),
+			404: errorResponse("Plan not found"),
+		},
+	},
+	"DELETE /api/v1/plans/{id}": {
+		Summary: "Move a plan to the trash",
+		Tag:     "plans",
+		Params:  []param{idParam, ifMatch},
+		Responses: map[int]response{
+			200: {Description: "Plan moved to trash", Body: message{}},
+			404: errorResponse("Plan not found"),
+			412: errorResponse("Plan has been modified"),
+		},
+	},
+	"PATCH /api/v1/plans/{id}": {
+		Summary: "Partially update a plan",
+		Tag:     "plans",
+		Params:  []param{idParam, ifMatchReq, idempotency},
+		Body:    models.Plan{},
+		Responses: map[int]response{
+			200: {Description: "The updated plan", Body: models.Plan{}},
+			400: errorResponse("Invalid update"),
+			404: errorResponse("Plan not found"),
+			412: errorResponse("Plan has been modified"),
+			422: errorResponse("Idempotency-Key reused for a different request"),
+			428: errorResponse("If-Match header is required"),
+		},
+	},
+	"GET /api/v1/plans/{id}/versions": {
+		Summary: "List the versions of a plan",
+		Tag:     "history",
+		Params:  []param{idParam},
+		Responses: map[int]response{
+			200: {Description: "Version metadata, oldest first", Body: models.PlanVersion{}, Array: true},
+			404: errorResponse("Plan not found"),
+		},
+	},
+	"GET /api/v1/plans/{id}/versions/{n}": {
+		Summary: "Get a version of a plan",
+		Tag:     "history",
+		Params:  []param{idParam, versionParam},
+		Responses: map[int]response{
+			200: {Description: "The version with its snapshot", Body: models.PlanVersion{}},
+			400: errorResponse("Version must be a number"),
+			404: errorResponse("Version not found"),
+		},
+	},
+	"POST /api/v1/plans/{id}/versions/{n}/restore": {
+		Summary: "Restore a version as the current plan",
+		Tag:     "history",
+		Params:  []param{idParam, versionParam, ifMatchReq},
+		Responses: map[int]response{
+			200: {Description: "The restored plan", Body: models.Plan{}},
+			404: errorResponse("Plan or version not found"),
+			412: errorResponse("Plan has been modified"),
+			428: errorResponse("If-Match header is required"),
+		},
+	},
+	"POST /api/v1/plans/{id}/restore": {
+		Summary: "Restore a plan from the trash",
+		Tag:     "trash",
+		Params:  []param{idParam},
+		Responses: map[int]response{
+			200: {Description: "The restored plan", Body: models.Plan{}},
+			404: errorResponse("Plan not in trash"),
+			409: errorResponse("A live plan with this id exists"),
+		},
+	},
+	"GET /api/v1/plans/{id}/diff": {
+		Summary: "Compare two versions of a plan",
+		Tag:     "history",
+		Params: []param{
+			idParam,
+			{Name: "from", In: "query", Type: "string", Description: "Version number or ETag, defaults to the version before to"},
+			{Name: "to", In: "query", Type: "string", Description: "Version number or ETag, defaults to the latest"},
+		},
+		Responses: map[int]response{
+			200: {Description: "Semantic diff", Body: models.PlanDiff{}},
+			400: errorResponse("No earlier version to compare with"),
+			404: errorResponse("Version not found"),
+		},
+	},
+	"GET /api/v1/plans/{id}/audit": {
+		Summary: "Audit trail of a plan",
+		Tag:     "audit",
+		Params:  []param{idParam},
+		Responses: map[int]response{
+			200: {Description: "Audit entries, oldest first", Body: models.AuditEntry{}, Array: true},
+			404: errorResponse("No audit entries"),
+		},
+	},
+	"POST /api/v1/graphql": {
+		Summary: "Query or change plans with GraphQL",
+		Tag:     "graphql",
+		Body:    graphqlRequest{},
+		Responses: map[int]response{
+			200: {Description: "Result; resolver errors carry the problem code and status in their extensions", Body: graphqlResponse{}},
+			400: errorResponse("Missing query"),
+		},
+	},
+	"GET /api/v1/audit": {
+		Summary: "Query the audit trail (admin)",
+		Tag:     "audit",
+		Params: []param{
+			{Name: "user", In: "query", Type: "string", Description: "Subject or email of the caller"},
+			{Name: "from", In: "query", Type: "string", Description: "RFC 3339 start time"},
+			{Name: "to", In: "query", Type: "string", Description: "RFC 3339 end time"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of entries"},
+		},
+		Responses: map[int]response{
+			200: {Description: "Matching audit entries", Body: models.AuditEntry{}, Array: true},
+			400: errorResponse("Invalid query"),
+			403: errorResponse("Admin access required"),
+		},
+	},
+	"POST /api/v1/webhooks": {
+		Summary: "Subscribe a webhook to plan events (admin)",
+		Tag:     "webhooks",
+		Body:    models.Webhook{},
+		Responses: map[int]response{
+			201: {Description: "Webhook created, including its signing secret", Body: models.Webhook{}},
+			400: errorResponse("Invalid URL or event type"),
+			403: errorResponse("Admin access required"),
+		},
+	},
+	"GET /api/v1/webhooks": {
+		Summary: "List webhooks (admin)",
+		Tag:     "webhooks",
+		Responses: map[int]response{
+			200: {Description: "All webhooks, without their secrets", Body: models.Webhook{}, Array: true},
+			403: errorResponse("Admin access required"),
+		},
+	},
+	"GET /api/v1/webhooks/{id}": {
+		Summary: "Get a webhook (admin)",
+		Tag:     "webhooks",
+		Params:  []param{webhookParam},
+		Responses: map[int]response{
+			200: {Description: "The webhook, without its secret", Body: models.Webhook{}},
+			403: errorResponse("Admin access required"),
+			404: errorResponse("Webhook not found"),
+		},
+	},
+	"PUT /api/v1/webhooks/{id}": {
+		Summary: "Replace the URL and filters of a webhook (admin)",
+		Tag:     "webhooks",
+		Params:  []param{webhookParam},
+		Body:    models.Webhook{},
+		Responses: map[int]response{
+			200: {Description: "Webhook updated; the secret changes only if one was sent", Body: models.Webhook{}},
+			400: errorResponse("Invalid URL or event type"),
+			403: errorResponse("Admin access required"),
+			404: errorResponse("Webhook not found"),
+		},
+	},
+	"DELETE /api/v1/webhooks/{id}": {
+		Summary: "Delete a webhook and its delivery log (admin)",
+		Tag:     "webhooks",
+		Params:  []param{webhookParam},
+		Responses: map[int]response{
+			204: {Description: "Webhook deleted"},
+			403: errorResponse("Admin access required"),
+			404: errorResponse("Webhook not found"),
+		},
+	},
+	"GET /api/v1/webhooks/{id}/deliveries": {
+		Summary: "Delivery log of a webhook (admin)",
+		Tag:     "webhooks",
+		Params: []param{
+			webhookParam,
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of deliveries, default 50"},
+		},
+		Responses: map[int]response{
+			200: {Description: "Deliveries, newest first", Body: models.WebhookDelivery{}, Array: true},
+			400: errorResponse("Invalid limit"),
+			403: errorResponse("Admin access required"),
+			404: errorResponse("Webhook not found"),
+		},
+	},
+	"POST /api/v1/webhooks/{id}/deliveries/{deliveryId}/redeliver": {
+		Summary: "Send an earlier delivery again (admin)",
+		Tag:     "webhooks",
+		Params: []param{
+			webhookParam,
+			{Name: "deliveryId", In: "path", Type: "string", Required: true, Description: "Delivery id from the delivery log"},
+		},
+		Responses: map[int]response{
+			200: {Description: "The new delivery, successful or not", Body: models.WebhookDelivery{}},
+			403: errorResponse("Admin access required"),
+			404: errorResponse("Webhook or delivery not found"),
+		},
+	},
+	"GET /healthz": {
+		Summary: "Liveness probe",
+		Tag:     "meta",
+		Public:  true,
+		Responses: map[int]response{
+			200: {Description: "The process is up", ContentType: "application/json"},
+		},
+	},
+	"GET /readyz": {
+		Summary: "Readiness probe",
+		Tag:     "meta",
+		Public:  true,
+		Responses: map[int]response{
+			200: {Description: "Redis, RabbitMQ and Elasticsearch are reachable, and with EVENT_BUS=memory the plans index exists", Body: health.Report{}},
+			503: {Description: "At least one dependency is down", Body: health.Report{}},
+		},
+	},
+	"GET /metrics": {
+		Summary: "Prometheus metrics",
+		Tag:     "meta",
+		Public:  true,
+		Responses: map[int]response{
+			200: {Description: "Metrics in the Prometheus text format", ContentType: "text/plain"},
+		},
+	},
+	"GET /api/v1/openapi.json": {
+		Summary: "This document",
+		Tag:     "meta",
+		Public:  true,
+		Responses: map[int]response{
+			200: {Description: "OpenAPI document", ContentType: "application/json"},
+		},
+	},
+	"GET /api/v1/docs": {
+		Summary: "Interactive API documentation",
+		Tag:     "meta",
+		Public:  true,
+		Responses: map[int]response{
+			200: {Description: "Documentation UI", ContentType: "text/html"},
+		},
+	},
+	"GET /api/v1/docs/{file}": {
+		Summary: "Script or stylesheet of the documentation UI",
+		Tag:     "meta",
+		Public:  true,
+		Params: []param{
+			{Name: "file", In: "path", Type: "string", Required: true, Description: "swagger-ui.css, swagger-ui-bundle.js or docs.js"},
+		},
+		Responses: map[int]response{
+			200: {Description: "The asset, as text/css or text/javascript", ContentType: "*/*"},
+			404: errorResponse("Unknown asset"),
+		},
+	},
+}
@@ -0,0 +1,4 @@
+// Package planspb is the Go code generated from proto/plans.proto.
+package planspb
+
+//go:generate protoc -I ../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative plans.proto
@@ -0,0 +1,183 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const ContentType = "application/problem+json"
+
+// Stable machine readable error codes. Each one also names the problem type
+// URI, so clients can switch on either.
+const (
+	CodeInvalidJSON           = "invalid-json"
+	CodeValidationFailed      = "validation-failed"
+	CodeInvalidParameter      = "invalid-parameter"
+	CodeUnauthorized          = "unauthorized"
+	CodeForbidden             = "forbidden"
+	CodeNotFound              = "not-found"
+	CodePlanNotFound          = "plan-not-found"
+	CodeVersionNotFound       = "version-not-found"
+	CodeWebhookNotFound       = "webhook-not-found"
+	CodeDeliveryNotFound      = "delivery-not-found"
+	CodePlanExists            = "plan-exists"
+	CodePreconditionFailed    = "precondition-failed"
+	CodePreconditionRequired  = "precondition-required"
+	CodeIdempotencyKeyReused  = "idempotency-key-reused"
+	CodeIdempotencyInProgress = "idempotency-in-progress"
+	CodeRequestTooLarge       = "request-too-large"
+	CodeClientError           = "client-error"
+	CodeInternal              = "internal-error"
+)
+
+// FieldError points at one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem detail. Handlers return it as an error and
+// the app's error handler writes it out as application/problem+json.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	ObjectId  string       `json:"objectId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	// cause is logged but never sent to the client
+	cause error
+}
+
+func (p *Problem) Error() string {
+	if p.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", p.Code, p.Detail, p.cause)
+	}
+	return fmt.Sprintf("%s: %s", p.Code, p.Detail)
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WithObject names the plan the problem is about.
+func (p *Problem) WithObject(objectId string) *Problem {
+	p.ObjectId = objectId
+	return p
+}
+
+// WithCause attaches the underlying error for the server log.
+func (p *Problem) WithCause(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+func BadRequest(code, detail string) *Problem {
+	return New(fiber.StatusBadRequest, code, detail)
+}
+
+func NotFound(code, detail string) *Problem {
+	return New(fiber.StatusNotFound, code, detail)
+}
+
+func Conflict(code, detail string) *Problem {
+	return New(fiber.StatusConflict, code, detail)
+}
+
+func PreconditionFailed(detail string) *Problem {
+	return New(fiber.StatusPreconditionFailed, CodePreconditionFailed, detail)
+}
+
+func PreconditionRequired(detail string) *Problem {
+	return New(fiber.StatusPreconditionRequired, CodePreconditionRequired, detail)
+}
+
+func Unauthorized(detail string) *Problem {
+	return New(fiber.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Problem {
+	return New(fiber.StatusForbidden, CodeForbidden, detail)
+}
+
+// Validation reports one or more invalid fields.
+func Validation(errs ...FieldError) *Problem {
+	p := BadRequest(CodeValidationFailed, "Validation failed")
+	p.Errors = errs
+	return p
+}
+
+// Internal hides err from the client behind a generic detail.
+func Internal(detail string, err error) *Problem {
+	return New(fiber.StatusInternalServerError, CodeInternal, detail).WithCause(err)
+}
+
+// fiberCode picks the code for one of Fiber's own errors. Statuses without
+// a code of their own are named after their status text, for example
+// "method-not-allowed"; only server errors are "internal-error".
+func fiberCode(status int) string {
+	switch status {
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusRequestEntityTooLarge:
+		return CodeRequestTooLarge
+	case fiber.StatusBadRequest:
+		return CodeInvalidJSON
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	if text := http.StatusText(status); text != "" {
+		return strings.ToLower(strings.ReplaceAll(text, " ", "-"))
+	}
+	return CodeClientError
+}
+
+// Handler is the Fiber error handler. Problems are written as they are,
+// Fiber's own errors (unknown route, body too large, ...) are mapped onto
+// problems, and anything else becomes an opaque 500.
+func Handler(c *fiber.Ctx, err error) error {
+	var p *Problem
+	var fe *fiber.Error
+
+	switch {
+	case errors.As(err, &p):
+	case errors.As(err, &fe):
+		p = New(fe.Code, fiberCode(fe.Code), fe.Message)
+	default:
+		p = Internal("Internal server error", err)
+	}
+
+	if p.Status >= fiber.StatusInternalServerError {
+		slog.ErrorContext(c.UserContext(), "Request failed", "method", c.Method(), "path", c.Path(), "error", p)
+	}
+
+	// Copy so the shared value is not mutated per request
+	out := *p
+	out.Instance = c.OriginalURL()
+	if id, ok := c.Locals("requestid").(string); ok {
+		out.RequestID = id
+	}
+
+	c.Set(fiber.HeaderContentType, ContentType)
+	return c.Status(out.Status).JSON(out, ContentType)
+}
@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultPrefetch     = 64
+	defaultRequeueDelay = time.Second
+	maxRequeueDelay     = 30 * time.Second
+)
+
+// job is a delivery together with the message decoded from it.
+type job struct {
+	delivery amqp.Delivery
+	message  models.PlanMessage
+}
+
+// pool handles deliveries on a fixed number of workers, each with its own
+// queue. Jobs are sharded by plan objectId, so the events of one plan are
+// applied in the order they were published while different plans are
+// indexed in parallel.
+type pool struct {
+	shards []chan job
+	wg     sync.WaitGroup
+}
+
+// newPool starts workers that call handle for every job of their shard.
+// The channel prefetch caps the unacknowledged deliveries, so a shard
+// buffer of that size never blocks dispatch.
+func newPool(workers, prefetch int, handle func(job)) *pool {
+	p := &pool{shards: make([]chan job, workers)}
+	for i := range p.shards {
+		shard := make(chan job, prefetch)
+		p.shards[i] = shard
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for j := range shard {
+				handle(j)
+			}
+		}()
+	}
+	return p
+}
+
+func (p *pool) dispatch(j job) {
+	h := fnv.New32a()
+	h.Write([]byte(j.message.Plan.ObjectId))
+	p.shards[h.Sum32()%uint32(len(p.shards))] <- j
+}
+
+// close waits for the workers to finish the jobs already dispatched.
+func (p *pool) close() {
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	p.wg.Wait()
+}
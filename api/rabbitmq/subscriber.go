@@ -0,0 +1,215 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/broker"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/logging"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Subscriber consumes one queue of the plans exchange on a pool of
+// workers. Events are sharded across the workers by plan objectId, so a
+// plan's events are handled in order while different plans are handled in
+// parallel. Deliveries are acknowledged once handled.
+type Subscriber struct {
+	Factory
+	Queue Queue
+
+	// Workers and Prefetch default to defaultWorkers and defaultPrefetch
+	Workers  int
+	Prefetch int
+
+	// RequeueDelay, by default defaultRequeueDelay, is how long a failed
+	// delivery waits before it is requeued. It doubles with every failure
+	// in a row, up to maxRequeueDelay, so a dependency that is down is not
+	// hammered with the same events.
+	RequeueDelay time.Duration
+	failures     atomic.Int32
+
+	// OnConnect, when set, is called once deliveries start
+	OnConnect func()
+}
+
+// Subscribe consumes until the RabbitMQ connection or channel goes away,
+// or until ctx is cancelled, and returns why. On cancellation the
+// deliveries already received are still handled before it returns.
+func (s *Subscriber) Subscribe(ctx context.Context, handle broker.Handler) error {
+	workers, prefetch := s.Workers, s.Prefetch
+	if workers < 1 {
+		workers = defaultWorkers
+	}
+	if prefetch < 1 {
+		prefetch = defaultPrefetch
+	}
+
+	// Connect to RabbitMQ
+	conn, err := s.NewConnection()
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	ch, err := s.NewChannel(conn)
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	// Deliveries are acknowledged once handled, and the prefetch bounds how
+	// many are handed to the workers at a time
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set QoS: %w", err)
+	}
+	if err := DeclareExchange(ch); err != nil {
+		return err
+	}
+	if err := s.Queue.Declare(ch); err != nil {
+		return err
+	}
+
+	consumerTag := s.Queue.Name
+	msgs, err := ch.Consume(
+		s.Queue.Name, // queue
+		consumerTag,  // consumer
+		false,        // auto-ack
+		false,        // exclusive
+		false,        // no-local
+		false,        // no-wait
+		nil,          // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	if s.OnConnect != nil {
+		s.OnConnect()
+	}
+	slog.Info("Waiting for messages", "queue", s.Queue.Name, "workers", workers, "prefetch", prefetch)
+
+	// Cancelling the consumer stops new deliveries and closes msgs once the
+	// buffered ones have been handed over
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := ch.Cancel(consumerTag, false); err != nil {
+				slog.Error("Failed to cancel consumer", "error", err)
+			}
+		case <-done:
+		}
+	}()
+
+	// The workers are drained before the channel is closed, so every
+	// dispatched delivery is acknowledged
+	workerPool := newPool(workers, prefetch, func(j job) {
+		s.handle(ctx, j, handle)
+	})
+	for d := range msgs {
+		// Deserialize the PlanMessage. A message that cannot be decoded
+		// never will be, so it is dropped instead of redelivered.
+		var planMessage models.PlanMessage
+		if err := json.Unmarshal(d.Body, &planMessage); err != nil {
+			slog.Error("Failed to deserialize PlanMessage, dropping it", "error", err)
+			if err := d.Nack(false, false); err != nil {
+				slog.Error("Failed to reject message", "error", err)
+			}
+			continue
+		}
+		workerPool.dispatch(job{delivery: d, message: planMessage})
+	}
+	workerPool.close()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	select {
+	case err := <-closed:
+		if err != nil {
+			return err
+		}
+	default:
+	}
+	return errors.New("delivery channel closed")
+}
+
+// handle passes one delivery to the handler and settles it. A failed
+// delivery is requeued after the requeue delay, or right away once ctx is
+// cancelled; if a later event of the same plan overtakes it in the
+// meantime, the sequence check makes the retry a no-op.
+func (s *Subscriber) handle(ctx context.Context, j job, handle broker.Handler) {
+	d, planMessage := j.delivery, j.message
+
+	// Continue the trace and request ID of the request that published
+	// the message, so the handler's work is its descendant and its log
+	// lines can be correlated with the API's
+	// A fresh context, so shutdown does not cut off a message halfway
+	msgCtx := otel.GetTextMapPropagator().Extract(context.Background(), tracing.TableCarrier(d.Headers))
+	if requestID, ok := d.Headers[RequestIDHeader].(string); ok {
+		msgCtx = logging.WithRequestID(msgCtx, requestID)
+	}
+	msgCtx, span := tracing.Tracer.Start(msgCtx, s.Queue.Name+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingDestinationName(s.Queue.Name),
+			semconv.MessagingRabbitmqDestinationRoutingKey(d.RoutingKey),
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingMessageID(planMessage.EventId),
+			attribute.String("plan.operation", planMessage.Operation),
+			attribute.String("plan.object_id", planMessage.Plan.ObjectId),
+			attribute.Int64("plan.sequence", planMessage.Sequence),
+		),
+	)
+
+	msg := broker.Message{Event: planMessage, Redelivered: d.Redelivered}
+	if writtenAt, ok := d.Headers[WrittenAtHeader].(int64); ok {
+		msg.PublishedAt = time.UnixMilli(writtenAt)
+	}
+
+	err := handle(msgCtx, msg)
+	tracing.End(span, err)
+	if err != nil {
+		delay := s.requeueDelay()
+		slog.ErrorContext(msgCtx, "Failed to handle message, requeueing it", "eventId", planMessage.EventId, "in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		if err := d.Nack(false, true); err != nil {
+			slog.ErrorContext(msgCtx, "Failed to requeue message", "error", err)
+		}
+		return
+	}
+	s.failures.Store(0)
+	if err := d.Ack(false); err != nil {
+		slog.ErrorContext(msgCtx, "Failed to acknowledge message", "error", err)
+	}
+}
+
+// requeueDelay counts a failure and returns how long to wait before
+// requeueing it.
+func (s *Subscriber) requeueDelay() time.Duration {
+	delay := s.RequeueDelay
+	if delay <= 0 {
+		delay = defaultRequeueDelay
+	}
+	for n := s.failures.Add(1); n > 1 && delay < maxRequeueDelay; n-- {
+		delay *= 2
+	}
+	return min(delay, maxRequeueDelay)
+}
@@ -0,0 +1,22 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequeueDelayBacksOff(t *testing.T) {
+	s := &Subscriber{RequeueDelay: 10 * time.Second}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, maxRequeueDelay, maxRequeueDelay}
+	for i, w := range want {
+		if got := s.requeueDelay(); got != w {
+			t.Errorf("failure %d: delay = %v, want %v", i+1, got, w)
+		}
+	}
+
+	// A success starts over
+	s.failures.Store(0)
+	if got := s.requeueDelay(); got != 10*time.Second {
+		t.Errorf("delay after a success = %v, want %v", got, 10*time.Second)
+	}
+}
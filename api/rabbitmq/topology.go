@@ -0,0 +1,157 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Plan events are published to one topic exchange with their event type
+// (models.EventPlanCreated and friends) as the routing key. Every consumer
+// declares and binds its own durable queue with the routing keys it cares
+// about, so adding a subscriber never takes events away from the existing
+// ones.
+const Exchange = "plans.events"
+
+// legacyQueue is where plan events went before the exchange existed.
+const legacyQueue = "plans_queue"
+
+// Queue is a durable queue bound to the exchange.
+type Queue struct {
+	Name        string
+	RoutingKeys []string
+}
+
+var (
+	// IndexerQueue feeds the Elasticsearch indexer every plan event.
+	IndexerQueue = Queue{Name: "plans.indexer", RoutingKeys: []string{"plan.*"}}
+
+	// WebhooksQueue feeds the webhook dispatcher every plan event; each
+	// webhook filters further.
+	WebhooksQueue = Queue{Name: "plans.webhooks", RoutingKeys: []string{"plan.*"}}
+)
+
+// DeclareExchange declares the plans exchange. Declaring is idempotent, so
+// publishers and consumers run it on every connection.
+func DeclareExchange(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(
+		Exchange, // name
+		"topic",  // kind
+		true,     // durable
+		false,    // auto-delete
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", Exchange, err)
+	}
+	return nil
+}
+
+// Declare declares the queue and binds it to the exchange with its routing
+// keys. Only the consumer of a queue declares it.
+func (q Queue) Declare(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		q.Name, // name
+		true,   // durable
+		false,  // delete when unused
+		false,  // exclusive
+		false,  // no-wait
+		nil,    // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", q.Name, err)
+	}
+	for _, key := range q.RoutingKeys {
+		if err := ch.QueueBind(q.Name, key, Exchange, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue %s to %s: %w", q.Name, key, err)
+		}
+	}
+	return nil
+}
+
+// MigrateLegacyQueue moves any events left in the old plans_queue onto the
+// exchange, routed by their operation, and deletes the queue once it is
+// empty. The consumer passes its queues, which are declared first so the
+// moved events have somewhere to go. It does nothing when the legacy queue
+// no longer exists.
+func (f *Factory) MigrateLegacyQueue(ctx context.Context, queues ...Queue) error {
+	conn, err := f.NewConnection()
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+
+	ch, err := f.NewChannel(conn)
+	if err != nil {
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+	defer ch.Close()
+
+	// A passive declare of a missing queue closes the channel, so check on
+	// a channel of its own
+	probe, err := f.NewChannel(conn)
+	if err != nil {
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+	if _, err := probe.QueueDeclarePassive(legacyQueue, false, false, false, false, nil); err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to check %s: %w", legacyQueue, err)
+	}
+	probe.Close()
+
+	if err := DeclareExchange(ch); err != nil {
+		return err
+	}
+	for _, queue := range queues {
+		if err := queue.Declare(ch); err != nil {
+			return err
+		}
+	}
+
+	moved := 0
+	for {
+		d, ok, err := ch.Get(legacyQueue, false)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", legacyQueue, err)
+		}
+		if !ok {
+			break
+		}
+
+		var message models.PlanMessage
+		if err := json.Unmarshal(d.Body, &message); err != nil {
+			slog.Error("Dropping unreadable message from legacy queue", "queue", legacyQueue, "error", err)
+			d.Nack(false, false)
+			continue
+		}
+		err = ch.PublishWithContext(ctx, Exchange, message.EventType(), false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			AppId:        appID,
+			Type:         message.EventType(),
+			Body:         d.Body,
+		})
+		if err != nil {
+			d.Nack(false, true)
+			return fmt.Errorf("failed to republish message from %s: %w", legacyQueue, err)
+		}
+		d.Ack(false)
+		moved++
+	}
+
+	if _, err := ch.QueueDelete(legacyQueue, false, true, false); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", legacyQueue, err)
+	}
+	slog.Info("Migrated legacy queue", "queue", legacyQueue, "messages", moved)
+	return nil
+}
@@ -0,0 +1,1017 @@
+// Package redistest runs an in-memory Redis that speaks enough of the
+// protocol for the commands the API uses, so handlers that read and write
+// plans can be tested without a Redis server. It supports strings, lists,
+// hashes, sorted sets and streams, key expiry, and MULTI/EXEC with WATCH.
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Server is an in-memory Redis listening on a loopback port.
+type Server struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	keys    map[string]*value
+	version map[string]uint64
+	clock   uint64
+}
+
+// Start runs a Server for the duration of the test and points
+// config.RedisClient at it, restoring the previous client afterwards.
+func Start(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{ln: ln, keys: map[string]*value{}, version: map[string]uint64{}}
+	go s.serve()
+
+	previous := config.RedisClient
+	config.RedisClient = redis.NewClient(&redis.Options{
+		Addr:            ln.Addr().String(),
+		Protocol:        2,
+		DisableIdentity: true,
+	})
+	t.Cleanup(func() {
+		config.RedisClient.Close()
+		config.RedisClient = previous
+		ln.Close()
+	})
+	return s
+}
+
+// Keys lists the keys currently set, in order.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.keys {
+		if s.lookup(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindList
+	kindHash
+	kindZSet
+	kindStream
+)
+
+type value struct {
+	kind     kind
+	str      string
+	list     []string
+	hash     map[string]string
+	zset     map[string]float64
+	stream   []streamEntry
+	lastID   streamID
+	expireAt time.Time
+}
+
+type streamID struct{ ms, seq uint64 }
+
+func (id streamID) String() string { return fmt.Sprintf("%d-%d", id.ms, id.seq) }
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+// Replies are built as values so EXEC can collect the replies of the
+// commands it runs.
+type (
+	status   string
+	errReply string
+	nilReply struct{}
+	nilArray struct{}
+)
+
+var (
+	errWrongType = errReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax    = errReply("ERR syntax error")
+	errNotInt    = errReply("ERR value is not an integer or out of range")
+	errNotFloat  = errReply("ERR value is not a valid float")
+)
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// client is the transaction state of one connection.
+type client struct {
+	watched map[string]uint64
+	multi   bool
+	queued  [][]string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	c := &client{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		writeReply(w, s.dispatch(c, args))
+		// Flush once the pipelined commands already read are answered
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) dispatch(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "MULTI":
+		if c.multi {
+			return errReply("ERR MULTI calls can not be nested")
+		}
+		c.multi = true
+		c.queued = nil
+		return status("OK")
+	case "DISCARD":
+		c.multi = false
+		c.queued = nil
+		c.watched = nil
+		return status("OK")
+	case "EXEC":
+		if !c.multi {
+			return errReply("ERR EXEC without MULTI")
+		}
+		return s.exec(c)
+	case "WATCH":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if c.watched == nil {
+			c.watched = map[string]uint64{}
+		}
+		for _, key := range args[1:] {
+			s.lookup(key)
+			c.watched[key] = s.version[key]
+		}
+		return status("OK")
+	case "UNWATCH":
+		c.watched = nil
+		return status("OK")
+	}
+	if c.multi {
+		c.queued = append(c.queued, args)
+		return status("QUEUED")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.run(args)
+}
+
+func (s *Server) exec(c *client) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queued, watched := c.queued, c.watched
+	c.multi, c.queued, c.watched = false, nil, nil
+	for key, version := range watched {
+		s.lookup(key)
+		if s.version[key] != version {
+			return nilArray{}
+		}
+	}
+	replies := make([]interface{}, len(queued))
+	for i, args := range queued {
+		replies[i] = s.run(args)
+	}
+	return replies
+}
+
+// lookup returns the value of key, expiring it first if it is due.
+func (s *Server) lookup(key string) *value {
+	v := s.keys[key]
+	if v != nil && !v.expireAt.IsZero() && !time.Now().Before(v.expireAt) {
+		delete(s.keys, key)
+		s.touch(key)
+		return nil
+	}
+	return v
+}
+
+// touch marks key as written, failing the transactions watching it.
+func (s *Server) touch(key string) {
+	s.clock++
+	s.version[key] = s.clock
+}
+
+// get returns the value of key if it has kind k, or creates it when
+// create is set.
+func (s *Server) get(key string, k kind, create bool) (*value, error) {
+	v := s.lookup(key)
+	if v == nil {
+		if !create {
+			return nil, nil
+		}
+		v = &value{kind: k, hash: map[string]string{}, zset: map[string]float64{}}
+		s.keys[key] = v
+		return v, nil
+	}
+	if v.kind != k {
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+func (s *Server) run(args []string) interface{} {
+	cmd, ok := commands[strings.ToUpper(args[0])]
+	if !ok {
+		return errReply(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	if len(args)-1 < cmd.minArgs {
+		return errReply(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+	}
+	reply, err := cmd.fn(s, args[1:])
+	var e errReply
+	if errors.As(err, &e) {
+		return e
+	} else if err != nil {
+		return errReply("ERR " + err.Error())
+	}
+	return reply
+}
+
+func (e errReply) Error() string { return string(e) }
+
+type command struct {
+	minArgs int
+	fn      func(s *Server, args []string) (interface{}, error)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":   {0, func(*Server, []string) (interface{}, error) { return status("PONG"), nil }},
+		"SELECT": {1, func(*Server, []string) (interface{}, error) { return status("OK"), nil }},
+		"GET":    {1, (*Server).cmdGet},
+		"SET":    {2, (*Server).cmdSet},
+		"SETNX":  {2, (*Server).cmdSetNX},
+		"MGET":   {1, (*Server).cmdMGet},
+		"DEL":    {1, (*Server).cmdDel},
+		"EXISTS": {1, (*Server).cmdExists},
+		"RENAME": {2, (*Server).cmdRename},
+		"INCR":   {1, (*Server).cmdIncr},
+		"SCAN":   {1, (*Server).cmdScan},
+
+		"HSET":    {3, (*Server).cmdHSet},
+		"HGET":    {2, (*Server).cmdHGet},
+		"HDEL":    {2, (*Server).cmdHDel},
+		"HGETALL": {1, (*Server).cmdHGetAll},
+
+		"ZADD":          {3, (*Server).cmdZAdd},
+		"ZREM":          {2, (*Server).cmdZRem},
+		"ZSCORE":        {2, (*Server).cmdZScore},
+		"ZRANGE":        {3, (*Server).cmdZRange},
+		"ZRANGEBYSCORE": {3, (*Server).cmdZRangeByScore},
+
+		"RPUSH":  {2, (*Server).cmdRPush},
+		"LRANGE": {3, (*Server).cmdLRange},
+		"LLEN":   {1, (*Server).cmdLLen},
+		"LINDEX": {2, (*Server).cmdLIndex},
+
+		"XADD":      {4, (*Server).cmdXAdd},
+		"XRANGE":    {3, (*Server).cmdXRange},
+		"XREVRANGE": {3, (*Server).cmdXRevRange},
+	}
+}
+
+func (s *Server) cmdGet(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindString, false)
+	if err != nil || v == nil {
+		return nilReply{}, err
+	}
+	return v.str, nil
+}
+
+func (s *Server) cmdSet(args []string) (interface{}, error) {
+	key := args[0]
+	var expireAt time.Time
+	nx, xx := false, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(args) {
+				return nil, errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, errNotInt
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expireAt = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return nil, errSyntax
+		}
+	}
+	existing := s.lookup(key)
+	if (nx && existing != nil) || (xx && existing == nil) {
+		return nilReply{}, nil
+	}
+	s.keys[key] = &value{kind: kindString, str: args[1], expireAt: expireAt}
+	s.touch(key)
+	return status("OK"), nil
+}
+
+func (s *Server) cmdSetNX(args []string) (interface{}, error) {
+	if s.lookup(args[0]) != nil {
+		return int64(0), nil
+	}
+	s.keys[args[0]] = &value{kind: kindString, str: args[1]}
+	s.touch(args[0])
+	return int64(1), nil
+}
+
+func (s *Server) cmdMGet(args []string) (interface{}, error) {
+	replies := make([]interface{}, len(args))
+	for i, key := range args {
+		if v := s.lookup(key); v != nil && v.kind == kindString {
+			replies[i] = v.str
+		} else {
+			replies[i] = nilReply{}
+		}
+	}
+	return replies, nil
+}
+
+func (s *Server) cmdDel(args []string) (interface{}, error) {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			delete(s.keys, key)
+			s.touch(key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Server) cmdExists(args []string) (interface{}, error) {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Server) cmdRename(args []string) (interface{}, error) {
+	v := s.lookup(args[0])
+	if v == nil {
+		return nil, errReply("ERR no such key")
+	}
+	delete(s.keys, args[0])
+	s.keys[args[1]] = v
+	s.touch(args[0])
+	s.touch(args[1])
+	return status("OK"), nil
+}
+
+func (s *Server) cmdIncr(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindString, true)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(0)
+	if v.str != "" {
+		if n, err = strconv.ParseInt(v.str, 10, 64); err != nil {
+			return nil, errNotInt
+		}
+	}
+	n++
+	v.str = strconv.FormatInt(n, 10)
+	s.touch(args[0])
+	return n, nil
+}
+
+// cmdScan returns every matching key in one page.
+func (s *Server) cmdScan(args []string) (interface{}, error) {
+	pattern := "*"
+	for i := 1; i+1 < len(args); i += 2 {
+		if strings.ToUpper(args[i]) == "MATCH" {
+			pattern = args[i+1]
+		}
+	}
+	keys := []interface{}{}
+	for key := range s.keys {
+		if s.lookup(key) == nil {
+			continue
+		}
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return []interface{}{"0", keys}, nil
+}
+
+func (s *Server) cmdHSet(args []string) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, errSyntax
+	}
+	v, err := s.get(args[0], kindHash, true)
+	if err != nil {
+		return nil, err
+	}
+	var added int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := v.hash[args[i]]; !ok {
+			added++
+		}
+		v.hash[args[i]] = args[i+1]
+	}
+	s.touch(args[0])
+	return added, nil
+}
+
+func (s *Server) cmdHGet(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindHash, false)
+	if err != nil || v == nil {
+		return nilReply{}, err
+	}
+	if field, ok := v.hash[args[1]]; ok {
+		return field, nil
+	}
+	return nilReply{}, nil
+}
+
+func (s *Server) cmdHDel(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindHash, false)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	var n int64
+	for _, field := range args[1:] {
+		if _, ok := v.hash[field]; ok {
+			delete(v.hash, field)
+			n++
+		}
+	}
+	if len(v.hash) == 0 {
+		delete(s.keys, args[0])
+	}
+	s.touch(args[0])
+	return n, nil
+}
+
+func (s *Server) cmdHGetAll(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindHash, false)
+	if err != nil {
+		return nil, err
+	}
+	replies := []interface{}{}
+	if v != nil {
+		fields := make([]string, 0, len(v.hash))
+		for field := range v.hash {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			replies = append(replies, field, v.hash[field])
+		}
+	}
+	return replies, nil
+}
+
+func (s *Server) cmdZAdd(args []string) (interface{}, error) {
+	i := 1
+	nx, xx, gt, lt, ch := false, false, false, false, false
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		default:
+			break flags
+		}
+	}
+	if (len(args)-i)%2 != 0 || i == len(args) {
+		return nil, errSyntax
+	}
+	v, err := s.get(args[0], kindZSet, true)
+	if err != nil {
+		return nil, err
+	}
+	var added, changed int64
+	for ; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return nil, errNotFloat
+		}
+		member := args[i+1]
+		old, exists := v.zset[member]
+		if (nx && exists) || (xx && !exists) || (exists && gt && score <= old) || (exists && lt && score >= old) {
+			continue
+		}
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+		v.zset[member] = score
+	}
+	if len(v.zset) == 0 {
+		delete(s.keys, args[0])
+	}
+	s.touch(args[0])
+	if ch {
+		return added + changed, nil
+	}
+	return added, nil
+}
+
+func (s *Server) cmdZRem(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindZSet, false)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := v.zset[member]; ok {
+			delete(v.zset, member)
+			n++
+		}
+	}
+	if len(v.zset) == 0 {
+		delete(s.keys, args[0])
+	}
+	s.touch(args[0])
+	return n, nil
+}
+
+func (s *Server) cmdZScore(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindZSet, false)
+	if err != nil || v == nil {
+		return nilReply{}, err
+	}
+	score, ok := v.zset[args[1]]
+	if !ok {
+		return nilReply{}, nil
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64), nil
+}
+
+type scored struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members of a sorted set in order.
+func (v *value) sorted() []scored {
+	members := make([]scored, 0, len(v.zset))
+	for member, score := range v.zset {
+		members = append(members, scored{member, score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func zreply(members []scored, withScores bool) []interface{} {
+	replies := []interface{}{}
+	for _, m := range members {
+		replies = append(replies, m.member)
+		if withScores {
+			replies = append(replies, strconv.FormatFloat(m.score, 'f', -1, 64))
+		}
+	}
+	return replies
+}
+
+func (s *Server) cmdZRange(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindZSet, false)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return []interface{}{}, nil
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return nil, errNotInt
+	}
+	withScores := len(args) > 3 && strings.ToUpper(args[3]) == "WITHSCORES"
+	members := v.sorted()
+	lo, hi, ok := listRange(len(members), start, stop)
+	if !ok {
+		return []interface{}{}, nil
+	}
+	return zreply(members[lo:hi], withScores), nil
+}
+
+func (s *Server) cmdZRangeByScore(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindZSet, false)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return []interface{}{}, nil
+	}
+	min, minOpen, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, maxOpen, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	withScores, offset, count := false, 0, -1
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, errSyntax
+			}
+			offset, _ = strconv.Atoi(args[i+1])
+			count, _ = strconv.Atoi(args[i+2])
+			i += 2
+		default:
+			return nil, errSyntax
+		}
+	}
+	var members []scored
+	for _, m := range v.sorted() {
+		if m.score < min || (minOpen && m.score == min) || m.score > max || (maxOpen && m.score == max) {
+			continue
+		}
+		members = append(members, m)
+	}
+	if offset >= len(members) {
+		members = nil
+	} else {
+		members = members[offset:]
+	}
+	if count >= 0 && count < len(members) {
+		members = members[:count]
+	}
+	return zreply(members, withScores), nil
+}
+
+func parseScoreBound(bound string) (float64, bool, error) {
+	open := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
+	switch bound {
+	case "-inf":
+		return math.Inf(-1), open, nil
+	case "+inf", "inf":
+		return math.Inf(1), open, nil
+	}
+	score, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, false, errReply("ERR min or max is not a float")
+	}
+	return score, open, nil
+}
+
+func (s *Server) cmdRPush(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindList, true)
+	if err != nil {
+		return nil, err
+	}
+	v.list = append(v.list, args[1:]...)
+	s.touch(args[0])
+	return int64(len(v.list)), nil
+}
+
+// listRange turns Redis start and stop indexes into a slice range.
+func listRange(n, start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start = max(start, 0)
+	stop = min(stop, n-1)
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+func (s *Server) cmdLRange(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindList, false)
+	if err != nil {
+		return nil, err
+	}
+	replies := []interface{}{}
+	if v == nil {
+		return replies, nil
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return nil, errNotInt
+	}
+	lo, hi, ok := listRange(len(v.list), start, stop)
+	if ok {
+		for _, item := range v.list[lo:hi] {
+			replies = append(replies, item)
+		}
+	}
+	return replies, nil
+}
+
+func (s *Server) cmdLLen(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindList, false)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	return int64(len(v.list)), nil
+}
+
+func (s *Server) cmdLIndex(args []string) (interface{}, error) {
+	v, err := s.get(args[0], kindList, false)
+	if err != nil || v == nil {
+		return nilReply{}, err
+	}
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errNotInt
+	}
+	if i < 0 {
+		i += len(v.list)
+	}
+	if i < 0 || i >= len(v.list) {
+		return nilReply{}, nil
+	}
+	return v.list[i], nil
+}
+
+func (s *Server) cmdXAdd(args []string) (interface{}, error) {
+	key := args[0]
+	maxLen := -1
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			if s.lookup(key) == nil {
+				return nilReply{}, nil
+			}
+		case "MAXLEN":
+			i++
+			if i < len(args) && (args[i] == "~" || args[i] == "=") {
+				i++
+			}
+			if i == len(args) {
+				return nil, errSyntax
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return nil, errNotInt
+			}
+			maxLen = n
+		default:
+			break options
+		}
+	}
+	if i == len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return nil, errSyntax
+	}
+	v, err := s.get(key, kindStream, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var id streamID
+	if args[i] == "*" {
+		id = streamID{ms: uint64(time.Now().UnixMilli())}
+		if !v.lastID.less(id) {
+			id = streamID{v.lastID.ms, v.lastID.seq + 1}
+		}
+	} else {
+		parsed, ok := parseStreamID(args[i], 0)
+		if !ok || !v.lastID.less(parsed) {
+			return nil, errReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+		id = parsed
+	}
+	v.lastID = id
+	v.stream = append(v.stream, streamEntry{id: id, fields: append([]string(nil), args[i+1:]...)})
+	if maxLen >= 0 && len(v.stream) > maxLen {
+		v.stream = v.stream[len(v.stream)-maxLen:]
+	}
+	s.touch(key)
+	return id.String(), nil
+}
+
+// parseStreamID reads an entry ID, where a missing sequence is seq.
+func parseStreamID(id string, seq uint64) (streamID, bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	if found {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return streamID{}, false
+		}
+	}
+	return streamID{ms, seq}, true
+}
+
+func parseRangeBound(bound string, low bool) (streamID, error) {
+	switch bound {
+	case "-":
+		return streamID{}, nil
+	case "+":
+		return streamID{^uint64(0), ^uint64(0)}, nil
+	}
+	seq := uint64(0)
+	if !low {
+		seq = ^uint64(0)
+	}
+	id, ok := parseStreamID(bound, seq)
+	if !ok {
+		return id, errReply("ERR Invalid stream ID specified as stream command argument")
+	}
+	return id, nil
+}
+
+func (s *Server) xrange(key, start, end string, countArgs []string, reverse bool) (interface{}, error) {
+	lo, err := parseRangeBound(start, true)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseRangeBound(end, false)
+	if err != nil {
+		return nil, err
+	}
+	count := -1
+	if len(countArgs) == 2 && strings.ToUpper(countArgs[0]) == "COUNT" {
+		if count, err = strconv.Atoi(countArgs[1]); err != nil {
+			return nil, errNotInt
+		}
+	} else if len(countArgs) != 0 {
+		return nil, errSyntax
+	}
+	v, err := s.get(key, kindStream, false)
+	if err != nil {
+		return nil, err
+	}
+	replies := []interface{}{}
+	if v == nil {
+		return replies, nil
+	}
+	entries := v.stream
+	for n := range entries {
+		e := entries[n]
+		if reverse {
+			e = entries[len(entries)-1-n]
+		}
+		if e.id.less(lo) || hi.less(e.id) {
+			continue
+		}
+		if count >= 0 && len(replies) == count {
+			break
+		}
+		fields := make([]interface{}, len(e.fields))
+		for i, f := range e.fields {
+			fields[i] = f
+		}
+		replies = append(replies, []interface{}{e.id.String(), fields})
+	}
+	return replies, nil
+}
+
+func (s *Server) cmdXRange(args []string) (interface{}, error) {
+	return s.xrange(args[0], args[1], args[2], args[3:], false)
+}
+
+func (s *Server) cmdXRevRange(args []string) (interface{}, error) {
+	return s.xrange(args[0], args[2], args[1], args[3:], true)
+}
+
+// readCommand reads one command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad array length %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("unexpected %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("bad bulk length %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch r := reply.(type) {
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", r)
+	case errReply:
+		fmt.Fprintf(w, "-%s\r\n", r)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", r)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(r), r)
+	case nilReply:
+		w.WriteString("$-1\r\n")
+	case nilArray:
+		w.WriteString("*-1\r\n")
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(r))
+		for _, item := range r {
+			writeReply(w, item)
+		}
+	default:
+		panic(fmt.Sprintf("redistest: unknown reply %T", reply))
+	}
+}
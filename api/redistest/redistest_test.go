@@ -0,0 +1,84 @@
+package redistest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCommands(t *testing.T) {
+	s := Start(t)
+	ctx := context.Background()
+	rdb := config.RedisClient
+
+	if err := rdb.Set(ctx, "a", "1", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := rdb.SetNX(ctx, "a", "2", time.Minute).Result(); err != nil || ok {
+		t.Errorf("SetNX on an existing key = %v, %v, want false", ok, err)
+	}
+	if n, err := rdb.Incr(ctx, "a").Result(); err != nil || n != 2 {
+		t.Errorf("Incr = %d, %v, want 2", n, err)
+	}
+	vals, err := rdb.MGet(ctx, "a", "missing").Result()
+	if err != nil || vals[0] != "2" || vals[1] != nil {
+		t.Errorf("MGet = %v, %v", vals, err)
+	}
+	if _, err := rdb.Get(ctx, "missing").Result(); err != redis.Nil {
+		t.Errorf("Get of a missing key = %v, want redis.Nil", err)
+	}
+	if err := rdb.Rename(ctx, "a", "b").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	rdb.RPush(ctx, "list", "x", "y", "z")
+	if items, _ := rdb.LRange(ctx, "list", 1, -1).Result(); len(items) != 2 || items[0] != "y" {
+		t.Errorf("LRange = %v", items)
+	}
+
+	rdb.ZAdd(ctx, "z", redis.Z{Score: 2, Member: "two"}, redis.Z{Score: 1, Member: "one"})
+	ids, _ := rdb.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: "-inf", Max: "1"}).Result()
+	if len(ids) != 1 || ids[0] != "one" {
+		t.Errorf("ZRangeByScore = %v", ids)
+	}
+
+	for range 3 {
+		rdb.XAdd(ctx, &redis.XAddArgs{Stream: "stream", MaxLen: 2, Values: map[string]interface{}{"k": "v"}})
+	}
+	msgs, err := rdb.XRange(ctx, "stream", "-", "+").Result()
+	if err != nil || len(msgs) != 2 || msgs[0].Values["k"] != "v" {
+		t.Errorf("XRange = %v, %v", msgs, err)
+	}
+
+	want := []string{"b", "list", "stream", "z"}
+	if keys := s.Keys(); !slices.Equal(keys, want) {
+		t.Errorf("Keys = %v, want %v", keys, want)
+	}
+}
+
+func TestWatchFailsOnConcurrentWrite(t *testing.T) {
+	Start(t)
+	ctx := context.Background()
+	rdb := config.RedisClient
+
+	err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+		// Another client writes the watched key before EXEC
+		rdb.Set(ctx, "k", "theirs", 0)
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "k", "ours", 0)
+			return nil
+		})
+		return err
+	}, "k")
+	if !errors.Is(err, redis.TxFailedErr) {
+		t.Fatalf("Watch = %v, want redis.TxFailedErr", err)
+	}
+	if val, _ := rdb.Get(ctx, "k").Result(); val != "theirs" {
+		t.Errorf("k = %q, want theirs", val)
+	}
+}
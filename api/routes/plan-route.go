@@ -2,15 +2,45 @@ package routes
 
 import (
 	"github.com/dumbresi/Healthcare-Plan-Management/api/controllers"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
 	"github.com/dumbresi/Healthcare-Plan-Management/api/middleware"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/openapi"
 	"github.com/gofiber/fiber/v2"
 )
 
 func SetupRoutes(app *fiber.App) {
+	// Only the bulk import reads a body larger than Fiber's default limit
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, "/api/v1/plans:bulk"))
+	app.Get("/healthz", controllers.Healthz)
+	app.Get("/readyz", controllers.Readyz)
+	app.Get("/metrics", metrics.Handler)
 	api := app.Group("/api/v1")
-	api.Post("/plans",middleware.AuthMiddleware, controllers.CreatePlan)
-	api.Get("/plans",middleware.AuthMiddleware,controllers.GetAllPlans)
-	api.Get("/plans/:id",middleware.AuthMiddleware, controllers.GetPlan)
-	api.Delete("/plans/:id",middleware.AuthMiddleware, controllers.DeletePlan)
-	api.Patch("/plans/:id",middleware.AuthMiddleware, controllers.PatchPlan)
+	api.Get("/openapi.json", openapi.Spec)
+	api.Get("/docs", openapi.Docs)
+	api.Get("/docs/:file", openapi.DocsAsset)
+	api.Post("/plans", middleware.AuthMiddleware, middleware.IdempotencyMiddleware, controllers.CreatePlan)
+	api.Get("/plans", middleware.AuthMiddleware, controllers.GetAllPlans)
+	api.Post("/plans\\:bulk", middleware.AuthMiddleware, controllers.BulkImportPlans)
+	api.Get("/plans\\:export", middleware.AuthMiddleware, controllers.ExportPlans)
+	api.Get("/plans/trash", middleware.AuthMiddleware, controllers.ListTrash)
+	api.Get("/plans/diff", middleware.AuthMiddleware, controllers.DiffPlans)
+	api.Get("/plans/events", middleware.AuthMiddleware, controllers.StreamPlanEvents)
+	api.Get("/plans/:id", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.GetPlan)
+	api.Delete("/plans/:id", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.DeletePlan)
+	api.Patch("/plans/:id", middleware.AuthMiddleware, middleware.PlanIdMiddleware, middleware.IdempotencyMiddleware, controllers.PatchPlan)
+	api.Get("/plans/:id/versions", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.ListPlanVersions)
+	api.Get("/plans/:id/versions/:n", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.GetPlanVersion)
+	api.Post("/plans/:id/versions/:n/restore", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.RestorePlanVersion)
+	api.Post("/plans/:id/restore", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.RestoreTrashedPlan)
+	api.Get("/plans/:id/diff", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.DiffPlanVersions)
+	api.Get("/plans/:id/audit", middleware.AuthMiddleware, middleware.PlanIdMiddleware, controllers.GetPlanAudit)
+	api.Post("/graphql", middleware.AuthMiddleware, controllers.GraphQL)
+	api.Get("/audit", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.QueryAudit)
+	api.Post("/webhooks", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.CreateWebhook)
+	api.Get("/webhooks", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.ListWebhooks)
+	api.Get("/webhooks/:id", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.GetWebhook)
+	api.Put("/webhooks/:id", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.UpdateWebhook)
+	api.Delete("/webhooks/:id", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.DeleteWebhook)
+	api.Get("/webhooks/:id/deliveries", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.ListWebhookDeliveries)
+	api.Post("/webhooks/:id/deliveries/:deliveryId/redeliver", middleware.AuthMiddleware, middleware.AdminMiddleware, controllers.RedeliverWebhook)
 }
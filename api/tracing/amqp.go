@@ -0,0 +1,26 @@
+package tracing
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TableCarrier adapts AMQP message headers to the propagation API, so
+// trace context travels with a message from publisher to consumer.
+type TableCarrier amqp.Table
+
+func (t TableCarrier) Get(key string) string {
+	v, _ := t[key].(string)
+	return v
+}
+
+func (t TableCarrier) Set(key, value string) {
+	t[key] = value
+}
+
+func (t TableCarrier) Keys() []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,240 @@
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/events"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/versions"
+	"github.com/redis/go-redis/v9"
+)
+
+// Deleted plans are renamed under the trash: prefix so every existing read
+// path stops seeing them, and indexed in a sorted set scored by deletion
+// time so the purger can find the expired ones cheaply.
+const (
+	Prefix     = "trash:"
+	indexKey   = "plans:trash"
+	deletedBy  = "plans:trash:by"
+	versionKey = ":versions"
+
+	defaultRetention     = 30 * 24 * time.Hour
+	defaultPurgeInterval = time.Hour
+	maxRestoreAttempts   = 3
+)
+
+var (
+	ErrNotFound = errors.New("plan not in trash")
+	ErrExists   = errors.New("a live plan with this id already exists")
+)
+
+// Retention is how long a deleted plan stays restorable. It is read from
+// TRASH_RETENTION (a Go duration) and defaults to 30 days.
+func Retention() time.Duration {
+	return config.DurationFromEnv("TRASH_RETENTION", defaultRetention)
+}
+
+// Move queues the commands that tombstone a live plan onto pipe, so the
+// caller can run them inside its own transaction. A copy already in the
+// trash under the same id is replaced.
+func Move(ctx context.Context, pipe redis.Pipeliner, objectId, by string) {
+	pipe.Rename(ctx, objectId, Prefix+objectId)
+	pipe.Rename(ctx, objectId+":etag", Prefix+objectId+":etag")
+	pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: objectId})
+	pipe.HSet(ctx, deletedBy, objectId, by)
+}
+
+// Restore brings a tombstoned plan back, recording it as a new version by
+// author, and returns it together with the event sequence number of the
+// restore. It runs as one WATCH/MULTI transaction, retried if a concurrent
+// create, delete or purge of the same id gets in first. record, when not
+// nil, queues further commands for the restore, such as its audit entry,
+// into that transaction, given the ETag and document of the plan.
+func Restore(ctx context.Context, objectId, author string, record func(pipe redis.Pipeliner, etag string, plan []byte) error) (models.Plan, int64, error) {
+	var plan models.Plan
+	var seq *redis.IntCmd
+
+	restore := func(tx *redis.Tx) error {
+		if _, err := tx.ZScore(ctx, indexKey, objectId).Result(); err == redis.Nil {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		// A plan recreated under the same id is never clobbered
+		live, err := tx.Exists(ctx, objectId).Result()
+		if err != nil {
+			return err
+		}
+		if live == 1 {
+			return ErrExists
+		}
+
+		val, err := tx.Get(ctx, Prefix+objectId).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read trashed plan: %w", err)
+		}
+		plan = models.Plan{}
+		if err := json.Unmarshal([]byte(val), &plan); err != nil {
+			return fmt.Errorf("failed to parse trashed plan: %w", err)
+		}
+		etag, err := tx.Get(ctx, Prefix+objectId+":etag").Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to read trashed plan ETag: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, Prefix+objectId, objectId)
+			if etag != "" {
+				pipe.Rename(ctx, Prefix+objectId+":etag", objectId+":etag")
+			}
+			pipe.ZRem(ctx, indexKey, objectId)
+			pipe.HDel(ctx, deletedBy, objectId)
+			seq = events.Next(ctx, pipe, objectId)
+			if err := versions.Append(ctx, pipe, objectId, etag, author, []byte(val)); err != nil {
+				return err
+			}
+			if record == nil {
+				return nil
+			}
+			return record(pipe, etag, []byte(val))
+		})
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt < maxRestoreAttempts; attempt++ {
+		err = config.RedisClient.Watch(ctx, restore, objectId, Prefix+objectId, Prefix+objectId+":etag")
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExists) {
+			return plan, 0, err
+		}
+		return plan, 0, fmt.Errorf("failed to restore plan: %w", err)
+	}
+	return plan, seq.Val(), nil
+}
+
+// List returns every plan currently in the trash, oldest deletion first.
+func List(ctx context.Context) ([]models.TrashedPlan, error) {
+	entries, err := config.RedisClient.ZRangeWithScores(ctx, indexKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	retention := Retention()
+	list := make([]models.TrashedPlan, 0, len(entries))
+	for _, z := range entries {
+		objectId := z.Member.(string)
+		deletedAt := time.UnixMilli(int64(z.Score)).UTC()
+
+		item := models.TrashedPlan{
+			ObjectId:  objectId,
+			DeletedAt: deletedAt.Format(time.RFC3339),
+			PurgeAt:   deletedAt.Add(retention).Format(time.RFC3339),
+		}
+		item.DeletedBy, _ = config.RedisClient.HGet(ctx, deletedBy, objectId).Result()
+
+		if val, err := config.RedisClient.Get(ctx, Prefix+objectId).Result(); err == nil {
+			var plan models.Plan
+			if json.Unmarshal([]byte(val), &plan) == nil {
+				item.Plan = &plan
+			}
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// Purge permanently removes plans that have been in the trash for longer
+// than the retention period, including their version history. It returns
+// the ids that were purged.
+func Purge(ctx context.Context) ([]string, error) {
+	cutoff := time.Now().Add(-Retention()).UnixMilli()
+	ids, err := config.RedisClient.ZRangeByScore(ctx, indexKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	purged := make([]string, 0, len(ids))
+	for _, objectId := range ids {
+		// WATCH so a restore or recreate racing the purge wins, and the
+		// plan is left for the next run to look at again
+		expired := false
+		err := config.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+			// The plan may have been restored and deleted again since the
+			// range was read, in which case its new copy is not due yet
+			score, err := tx.ZScore(ctx, indexKey, objectId).Result()
+			if err == redis.Nil || (err == nil && int64(score) > cutoff) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			expired = true
+
+			keys := []string{Prefix + objectId, Prefix + objectId + ":etag"}
+
+			// The history belongs to the id, so keep it if the plan was
+			// recreated while the old one sat in the trash. The event
+			// sequence is never purged (see events.SequenceSuffix).
+			live, err := tx.Exists(ctx, objectId).Result()
+			if err != nil {
+				return err
+			}
+			if live == 0 {
+				keys = append(keys, objectId+versionKey)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, keys...)
+				pipe.ZRem(ctx, indexKey, objectId)
+				pipe.HDel(ctx, deletedBy, objectId)
+				return nil
+			})
+			return err
+		}, objectId, Prefix+objectId)
+		if errors.Is(err, redis.TxFailedErr) || (err == nil && !expired) {
+			continue
+		} else if err != nil {
+			return purged, fmt.Errorf("failed to purge plan %s: %w", objectId, err)
+		}
+		purged = append(purged, objectId)
+	}
+	return purged, nil
+}
+
+// StartPurger runs Purge every TRASH_PURGE_INTERVAL (default one hour)
+// until ctx is cancelled.
+func StartPurger(ctx context.Context) {
+	interval := config.DurationFromEnv("TRASH_PURGE_INTERVAL", defaultPurgeInterval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ids, err := Purge(ctx)
+				if err != nil {
+					slog.Error("Trash purge failed", "error", err)
+				} else if len(ids) > 0 {
+					slog.Info("Purged plans from trash", "count", len(ids), "objectIds", ids)
+				}
+			}
+		}
+	}()
+}
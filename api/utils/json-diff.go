@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// JSONDiffOp is a single change between two JSON documents, loosely
+// modelled on RFC 6902 JSON Patch with the previous value kept alongside.
+type JSONDiffOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  interface{} `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// DiffJSON compares two JSON documents. A nil or empty side is treated as
+// absent, so creates come out as a single "add" and deletes as a "remove".
+func DiffJSON(before, after []byte) ([]JSONDiffOp, error) {
+	var left, right interface{}
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &left); err != nil {
+			return nil, fmt.Errorf("invalid before document: %w", err)
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &right); err != nil {
+			return nil, fmt.Errorf("invalid after document: %w", err)
+		}
+	}
+
+	ops := []JSONDiffOp{}
+	switch {
+	case left == nil && right == nil:
+	case left == nil:
+		ops = append(ops, JSONDiffOp{Op: "add", Path: "", Value: right})
+	case right == nil:
+		ops = append(ops, JSONDiffOp{Op: "remove", Path: "", From: left})
+	default:
+		diffValues("", left, right, &ops)
+	}
+	return ops, nil
+}
+
+func diffValues(path string, left, right interface{}, ops *[]JSONDiffOp) {
+	switch l := left.(type) {
+	case map[string]interface{}:
+		r, ok := right.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(l)+len(r))
+		for k := range l {
+			keys = append(keys, k)
+		}
+		for k := range r {
+			if _, seen := l[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + escapePointer(k)
+			lv, inLeft := l[k]
+			rv, inRight := r[k]
+			switch {
+			case !inLeft:
+				*ops = append(*ops, JSONDiffOp{Op: "add", Path: child, Value: rv})
+			case !inRight:
+				*ops = append(*ops, JSONDiffOp{Op: "remove", Path: child, From: lv})
+			default:
+				diffValues(child, lv, rv, ops)
+			}
+		}
+		return
+	case []interface{}:
+		r, ok := right.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(l) || i < len(r); i++ {
+			child := fmt.Sprintf("%s/%d", path, i)
+			switch {
+			case i >= len(r):
+				*ops = append(*ops, JSONDiffOp{Op: "remove", Path: child, From: l[i]})
+			case i >= len(l):
+				*ops = append(*ops, JSONDiffOp{Op: "add", Path: child, Value: r[i]})
+			default:
+				diffValues(child, l[i], r[i], ops)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(left, right) {
+		*ops = append(*ops, JSONDiffOp{Op: "replace", Path: path, From: left, Value: right})
+	}
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
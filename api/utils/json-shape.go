@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSONShape selects how much of a JSON document to return. Child objects,
+// the nested objects carrying an objectId, are inlined up to Depth levels
+// below the root and otherwise replaced by a reference holding only their
+// objectId and objectType. Fields then keeps only the named fields.
+//
+// Paths are dotted field names such as planCostShares.copay; a path
+// through an array applies to every element.
+type JSONShape struct {
+	// Fields to keep. Naming a field inside a child inlines that child.
+	// Empty keeps every field.
+	Fields []string
+	// Children to inline whatever Depth says
+	Expand []string
+	// Levels of children to inline; negative inlines all of them
+	Depth int
+}
+
+// Apply shapes the document in data. Paths that name no field of the
+// document are an error.
+func (s JSONShape) Apply(data []byte) (interface{}, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for _, path := range s.Fields {
+		if err := checkPath(doc, path, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range s.Expand {
+		if err := checkPath(doc, path, true); err != nil {
+			return nil, err
+		}
+	}
+
+	doc = s.inline(doc, "", 0)
+	if len(s.Fields) > 0 {
+		doc = project(doc, fieldTree(s.Fields))
+	}
+	return doc, nil
+}
+
+// inline walks value, found at path and level, replacing the children that
+// stay collapsed with references.
+func (s JSONShape) inline(value interface{}, path string, level int) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = s.inlineChild(child, joinPath(path, key), level)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = s.inlineChild(item, path, level)
+		}
+		return v
+	}
+	return value
+}
+
+// inlineChild handles the value of a field or array element, which is a
+// child one level down when it is an object with an objectId.
+func (s JSONShape) inlineChild(value interface{}, path string, level int) interface{} {
+	object, ok := value.(map[string]interface{})
+	if !ok || object["objectId"] == nil {
+		return s.inline(value, path, level)
+	}
+	if !s.inlined(path, level+1) {
+		return map[string]interface{}{"objectId": object["objectId"], "objectType": object["objectType"]}
+	}
+	return s.inline(object, path, level+1)
+}
+
+func (s JSONShape) inlined(path string, level int) bool {
+	if s.Depth < 0 || level <= s.Depth {
+		return true
+	}
+	for _, expand := range s.Expand {
+		if expand == path || strings.HasPrefix(expand, path+".") {
+			return true
+		}
+	}
+	for _, field := range s.Fields {
+		if strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPath reports an error if path names no field of doc, or with child
+// set, no child object. Paths below null values and empty arrays cannot be
+// checked and are accepted.
+func checkPath(doc interface{}, path string, child bool) error {
+	values := []interface{}{doc}
+	for _, key := range strings.Split(path, ".") {
+		var next []interface{}
+		for _, value := range values {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unknown field %q", path)
+			}
+			field, found := object[key]
+			if !found {
+				return fmt.Errorf("unknown field %q", path)
+			}
+			if items, ok := field.([]interface{}); ok {
+				next = append(next, items...)
+			} else if field != nil {
+				next = append(next, field)
+			}
+		}
+		values = next
+	}
+	if child {
+		for _, value := range values {
+			if object, ok := value.(map[string]interface{}); !ok || object["objectId"] == nil {
+				return fmt.Errorf("%q is not an embedded object", path)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonFieldTree holds the fields to keep. A nil subtree keeps the whole
+// field.
+type jsonFieldTree map[string]jsonFieldTree
+
+// fieldTree turns dotted paths into a jsonFieldTree. A path wins over
+// longer paths below it.
+func fieldTree(paths []string) jsonFieldTree {
+	tree := jsonFieldTree{}
+	for _, path := range paths {
+		node := tree
+		keys := strings.Split(path, ".")
+		for i, key := range keys {
+			sub, seen := node[key]
+			if seen && sub == nil {
+				break
+			}
+			if i == len(keys)-1 {
+				node[key] = nil
+				break
+			}
+			if sub == nil {
+				sub = jsonFieldTree{}
+				node[key] = sub
+			}
+			node = sub
+		}
+	}
+	return tree
+}
+
+func project(value interface{}, tree jsonFieldTree) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		kept := make(map[string]interface{}, len(tree))
+		for key, sub := range tree {
+			field, found := v[key]
+			if !found {
+				continue
+			}
+			if sub == nil {
+				kept[key] = field
+			} else {
+				kept[key] = project(field, sub)
+			}
+		}
+		return kept
+	case []interface{}:
+		for i, item := range v {
+			v[i] = project(item, tree)
+		}
+		return v
+	}
+	return value
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
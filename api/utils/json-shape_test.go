@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const shapeTestPlan = `{
+	"objectId": "p1",
+	"objectType": "plan",
+	"_org": "example.com",
+	"planCostShares": {"objectId": "c1", "objectType": "membercostshare", "copay": 23, "deductible": 2000},
+	"linkedPlanServices": [{
+		"objectId": "s1",
+		"objectType": "planservice",
+		"linkedService": {"objectId": "l1", "objectType": "service", "name": "Yearly physical"},
+		"planserviceCostShares": {"objectId": "c2", "objectType": "membercostshare", "copay": 0}
+	}]
+}`
+
+func TestJSONShapeApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		shape JSONShape
+		want  string
+	}{
+		{
+			name:  "negative depth returns everything",
+			shape: JSONShape{Depth: -1},
+			want:  shapeTestPlan,
+		},
+		{
+			name:  "depth 0 collapses every child",
+			shape: JSONShape{Depth: 0},
+			want: `{
+				"objectId": "p1", "objectType": "plan", "_org": "example.com",
+				"planCostShares": {"objectId": "c1", "objectType": "membercostshare"},
+				"linkedPlanServices": [{"objectId": "s1", "objectType": "planservice"}]
+			}`,
+		},
+		{
+			name:  "depth 1 collapses grandchildren",
+			shape: JSONShape{Depth: 1},
+			want: `{
+				"objectId": "p1", "objectType": "plan", "_org": "example.com",
+				"planCostShares": {"objectId": "c1", "objectType": "membercostshare", "copay": 23, "deductible": 2000},
+				"linkedPlanServices": [{
+					"objectId": "s1", "objectType": "planservice",
+					"linkedService": {"objectId": "l1", "objectType": "service"},
+					"planserviceCostShares": {"objectId": "c2", "objectType": "membercostshare"}
+				}]
+			}`,
+		},
+		{
+			name:  "expand inlines the path down to the child",
+			shape: JSONShape{Expand: []string{"linkedPlanServices.linkedService"}, Depth: 0},
+			want: `{
+				"objectId": "p1", "objectType": "plan", "_org": "example.com",
+				"planCostShares": {"objectId": "c1", "objectType": "membercostshare"},
+				"linkedPlanServices": [{
+					"objectId": "s1", "objectType": "planservice",
+					"linkedService": {"objectId": "l1", "objectType": "service", "name": "Yearly physical"},
+					"planserviceCostShares": {"objectId": "c2", "objectType": "membercostshare"}
+				}]
+			}`,
+		},
+		{
+			// ?fields alone leaves the depth unlimited
+			name:  "field naming a child without depth keeps it whole",
+			shape: JSONShape{Fields: []string{"planCostShares"}, Depth: -1},
+			want:  `{"planCostShares": {"objectId": "c1", "objectType": "membercostshare", "copay": 23, "deductible": 2000}}`,
+		},
+		{
+			// ?expand makes the depth 0, so a child named in ?fields but
+			// not expanded is only a reference
+			name:  "field naming a child with depth 0 keeps its reference",
+			shape: JSONShape{Fields: []string{"planCostShares"}, Expand: []string{"linkedPlanServices"}, Depth: 0},
+			want:  `{"planCostShares": {"objectId": "c1", "objectType": "membercostshare"}}`,
+		},
+		{
+			name:  "field inside a child inlines it",
+			shape: JSONShape{Fields: []string{"objectId", "planCostShares.copay"}, Depth: 0},
+			want:  `{"objectId": "p1", "planCostShares": {"copay": 23}}`,
+		},
+		{
+			name:  "field through an array applies to every element",
+			shape: JSONShape{Fields: []string{"linkedPlanServices.linkedService.name"}, Depth: -1},
+			want:  `{"linkedPlanServices": [{"linkedService": {"name": "Yearly physical"}}]}`,
+		},
+		{
+			name:  "field wins over longer paths below it",
+			shape: JSONShape{Fields: []string{"planCostShares.copay", "planCostShares"}, Depth: -1},
+			want:  `{"planCostShares": {"objectId": "c1", "objectType": "membercostshare", "copay": 23, "deductible": 2000}}`,
+		},
+		{
+			name:  "path below null is accepted",
+			doc:   `{"objectId": "p1", "planCostShares": null}`,
+			shape: JSONShape{Fields: []string{"planCostShares.copay"}, Depth: -1},
+			want:  `{"planCostShares": null}`,
+		},
+		{
+			name:  "path below an empty array is accepted",
+			doc:   `{"objectId": "p1", "linkedPlanServices": []}`,
+			shape: JSONShape{Expand: []string{"linkedPlanServices.linkedService"}, Depth: 0},
+			want:  `{"objectId": "p1", "linkedPlanServices": []}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := tt.doc
+			if doc == "" {
+				doc = shapeTestPlan
+			}
+			got, err := tt.shape.Apply([]byte(doc))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			var want interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				data, _ := json.Marshal(got)
+				t.Errorf("got %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONShapeApplyRejectsBadPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape JSONShape
+	}{
+		{"unknown field", JSONShape{Fields: []string{"premium"}}},
+		{"unknown field in a child", JSONShape{Fields: []string{"planCostShares.premium"}}},
+		{"unknown field in an array", JSONShape{Fields: []string{"linkedPlanServices.premium"}}},
+		{"field below a scalar", JSONShape{Fields: []string{"planCostShares.copay.amount"}}},
+		{"expand of a scalar", JSONShape{Expand: []string{"objectType"}}},
+		{"expand of a scalar in an array", JSONShape{Expand: []string{"linkedPlanServices.objectId"}}},
+		{"unknown expand", JSONShape{Expand: []string{"planCostShare"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.shape.Apply([]byte(shapeTestPlan)); err == nil {
+				data, _ := json.Marshal(got)
+				t.Errorf("Apply succeeded with %s, want an error", data)
+			}
+		})
+	}
+}
+
+func TestJSONShapeApplyRejectsInvalidJSON(t *testing.T) {
+	if _, err := (JSONShape{Depth: -1}).Apply([]byte(`{"objectId":`)); err == nil {
+		t.Error("Apply succeeded, want an error")
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+)
+
+// DiffPlans produces a semantic diff of two plans. Linked services are
+// paired by objectId first, so versions of the same plan line up exactly,
+// and then by linked service name, which is what lines up two different
+// plans covering the same service.
+func DiffPlans(left, right models.Plan) models.PlanDiff {
+	diff := models.PlanDiff{
+		Left:                  left.ObjectId,
+		Right:                 right.ObjectId,
+		Plan:                  []models.FieldChange{},
+		PlanCostShares:        []models.FieldChange{},
+		LinkedServicesAdded:   []models.LinkedPlanService{},
+		LinkedServicesRemoved: []models.LinkedPlanService{},
+		LinkedServicesChanged: []models.LinkedPlanServiceChange{},
+	}
+
+	compareField(&diff.Plan, "objectId", left.ObjectId, right.ObjectId)
+	compareField(&diff.Plan, "objectType", left.ObjectType, right.ObjectType)
+	compareField(&diff.Plan, "_org", left.Org, right.Org)
+	compareField(&diff.Plan, "creationDate", left.CreationDate, right.CreationDate)
+
+	var lcs, rcs models.PlanCostShares
+	if left.PlanCostShares != nil {
+		lcs = *left.PlanCostShares
+	}
+	if right.PlanCostShares != nil {
+		rcs = *right.PlanCostShares
+	}
+	compareField(&diff.PlanCostShares, "objectId", lcs.ObjectId, rcs.ObjectId)
+	compareField(&diff.PlanCostShares, "copay", lcs.Copay, rcs.Copay)
+	compareField(&diff.PlanCostShares, "deductible", lcs.Deductible, rcs.Deductible)
+	compareField(&diff.PlanCostShares, "_org", lcs.Org, rcs.Org)
+	compareField(&diff.PlanCostShares, "objectType", lcs.ObjectType, rcs.ObjectType)
+
+	matched := make(map[int]bool)
+	unmatched := []models.LinkedPlanService{}
+
+	// First pass: same objectId
+	byId := make(map[string]int)
+	for i, s := range right.LinkedPlanServices {
+		byId[s.ObjectId] = i
+	}
+	for _, l := range left.LinkedPlanServices {
+		if i, ok := byId[l.ObjectId]; ok && !matched[i] {
+			matched[i] = true
+			addServiceChange(&diff, l, right.LinkedPlanServices[i], "objectId")
+			continue
+		}
+		unmatched = append(unmatched, l)
+	}
+
+	// Second pass: same linked service name among what is left
+	for _, l := range unmatched {
+		found := false
+		for i, r := range right.LinkedPlanServices {
+			if matched[i] || r.LinkedService.Name == "" || r.LinkedService.Name != l.LinkedService.Name {
+				continue
+			}
+			matched[i] = true
+			found = true
+			addServiceChange(&diff, l, r, "name")
+			break
+		}
+		if !found {
+			diff.LinkedServicesRemoved = append(diff.LinkedServicesRemoved, l)
+		}
+	}
+
+	for i, r := range right.LinkedPlanServices {
+		if !matched[i] {
+			diff.LinkedServicesAdded = append(diff.LinkedServicesAdded, r)
+		}
+	}
+
+	return diff
+}
+
+func addServiceChange(diff *models.PlanDiff, left, right models.LinkedPlanService, matchedBy string) {
+	changes := []models.FieldChange{}
+	if matchedBy != "objectId" {
+		compareField(&changes, "objectId", left.ObjectId, right.ObjectId)
+	}
+	compareField(&changes, "_org", left.Org, right.Org)
+	compareField(&changes, "objectType", left.ObjectType, right.ObjectType)
+	compareField(&changes, "linkedService.objectId", left.LinkedService.ObjectId, right.LinkedService.ObjectId)
+	compareField(&changes, "linkedService.objectType", left.LinkedService.ObjectType, right.LinkedService.ObjectType)
+	compareField(&changes, "linkedService.name", left.LinkedService.Name, right.LinkedService.Name)
+	compareField(&changes, "linkedService._org", left.LinkedService.Org, right.LinkedService.Org)
+	compareField(&changes, "planserviceCostShares.objectId", left.PlanServiceCostShares.ObjectId, right.PlanServiceCostShares.ObjectId)
+	compareField(&changes, "planserviceCostShares.objectType", left.PlanServiceCostShares.ObjectType, right.PlanServiceCostShares.ObjectType)
+	compareField(&changes, "planserviceCostShares.copay", left.PlanServiceCostShares.Copay, right.PlanServiceCostShares.Copay)
+	compareField(&changes, "planserviceCostShares.deductible", left.PlanServiceCostShares.Deductible, right.PlanServiceCostShares.Deductible)
+	compareField(&changes, "planserviceCostShares._org", left.PlanServiceCostShares.Org, right.PlanServiceCostShares.Org)
+
+	if len(changes) == 0 {
+		return
+	}
+	diff.LinkedServicesChanged = append(diff.LinkedServicesChanged, models.LinkedPlanServiceChange{
+		ObjectId:  right.ObjectId,
+		Name:      right.LinkedService.Name,
+		MatchedBy: matchedBy,
+		Changes:   changes,
+	})
+}
+
+func compareField[T comparable](changes *[]models.FieldChange, field string, from, to T) {
+	if from != to {
+		*changes = append(*changes, models.FieldChange{Field: field, From: from, To: to})
+	}
+}
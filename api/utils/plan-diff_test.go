@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+)
+
+// diffTestPlan parses shapeTestPlan afresh, so a test can change its copy.
+func diffTestPlan(t *testing.T) models.Plan {
+	t.Helper()
+	var plan models.Plan
+	if err := json.Unmarshal([]byte(shapeTestPlan), &plan); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestDiffPlans(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(plan *models.Plan)
+		want   string
+	}{
+		{
+			name:   "identical plans",
+			change: func(*models.Plan) {},
+			want:   `{}`,
+		},
+		{
+			name:   "plan field",
+			change: func(plan *models.Plan) { plan.Org = "example.org" },
+			want:   `{"plan": [{"field": "_org", "from": "example.com", "to": "example.org"}]}`,
+		},
+		{
+			name: "plan cost shares objectId and objectType",
+			change: func(plan *models.Plan) {
+				plan.PlanCostShares.ObjectId = "c9"
+				plan.PlanCostShares.ObjectType = "costshare"
+			},
+			want: `{"planCostShares": [
+				{"field": "objectId", "from": "c1", "to": "c9"},
+				{"field": "objectType", "from": "membercostshare", "to": "costshare"}
+			]}`,
+		},
+		{
+			name:   "plan cost shares removed",
+			change: func(plan *models.Plan) { plan.PlanCostShares = nil },
+			want: `{"planCostShares": [
+				{"field": "objectId", "from": "c1", "to": ""},
+				{"field": "copay", "from": 23, "to": 0},
+				{"field": "deductible", "from": 2000, "to": 0},
+				{"field": "objectType", "from": "membercostshare", "to": ""}
+			]}`,
+		},
+		{
+			name: "linked service objectId and objectType",
+			change: func(plan *models.Plan) {
+				plan.LinkedPlanServices[0].LinkedService.ObjectId = "l9"
+				plan.LinkedPlanServices[0].LinkedService.ObjectType = "labservice"
+			},
+			want: `{"linkedServicesChanged": [{"objectId": "s1", "name": "Yearly physical", "matchedBy": "objectId", "changes": [
+				{"field": "linkedService.objectId", "from": "l1", "to": "l9"},
+				{"field": "linkedService.objectType", "from": "service", "to": "labservice"}
+			]}]}`,
+		},
+		{
+			name: "plan service cost shares objectId and objectType",
+			change: func(plan *models.Plan) {
+				plan.LinkedPlanServices[0].PlanServiceCostShares.ObjectId = "c9"
+				plan.LinkedPlanServices[0].PlanServiceCostShares.ObjectType = "costshare"
+			},
+			want: `{"linkedServicesChanged": [{"objectId": "s1", "name": "Yearly physical", "matchedBy": "objectId", "changes": [
+				{"field": "planserviceCostShares.objectId", "from": "c2", "to": "c9"},
+				{"field": "planserviceCostShares.objectType", "from": "membercostshare", "to": "costshare"}
+			]}]}`,
+		},
+		{
+			name:   "service with a new objectId is matched by name",
+			change: func(plan *models.Plan) { plan.LinkedPlanServices[0].ObjectId = "s9" },
+			want: `{"linkedServicesChanged": [{"objectId": "s9", "name": "Yearly physical", "matchedBy": "name", "changes": [
+				{"field": "objectId", "from": "s1", "to": "s9"}
+			]}]}`,
+		},
+		{
+			name: "service replaced by another",
+			change: func(plan *models.Plan) {
+				plan.LinkedPlanServices[0].ObjectId = "s9"
+				plan.LinkedPlanServices[0].LinkedService.Name = "Dental"
+			},
+			want: `{
+				"linkedServicesAdded": [{
+					"objectId": "s9", "objectType": "planservice", "_org": "",
+					"linkedService": {"objectId": "l1", "objectType": "service", "name": "Dental", "_org": ""},
+					"planserviceCostShares": {"objectId": "c2", "objectType": "membercostshare", "copay": 0, "deductible": 0, "_org": ""}
+				}],
+				"linkedServicesRemoved": [{
+					"objectId": "s1", "objectType": "planservice", "_org": "",
+					"linkedService": {"objectId": "l1", "objectType": "service", "name": "Yearly physical", "_org": ""},
+					"planserviceCostShares": {"objectId": "c2", "objectType": "membercostshare", "copay": 0, "deductible": 0, "_org": ""}
+				}]
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, right := diffTestPlan(t), diffTestPlan(t)
+			tt.change(&right)
+
+			// want lists only the parts of the diff that are not empty
+			want := map[string]interface{}{
+				"left": "p1", "right": "p1",
+				"plan": []interface{}{}, "planCostShares": []interface{}{},
+				"linkedServicesAdded": []interface{}{}, "linkedServicesRemoved": []interface{}{},
+				"linkedServicesChanged": []interface{}{},
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := json.Marshal(DiffPlans(left, right))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				wantData, _ := json.Marshal(want)
+				t.Errorf("got %s, want %s", data, wantData)
+			}
+		})
+	}
+}
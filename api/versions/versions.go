@@ -0,0 +1,176 @@
+package versions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound is returned when a plan has no version matching the request.
+var ErrNotFound = errors.New("version not found")
+
+// Every stored representation of a plan is appended to a Redis list under
+// <objectId>:versions. Version n is the n-th element (1 based), so numbers
+// are never reused and the list doubles as the plan's history. A delete
+// appends a marker without a plan, so reads after it see the plan as gone.
+type record struct {
+	ETag      string          `json:"etag"`
+	Timestamp string          `json:"timestamp"`
+	Author    string          `json:"author,omitempty"`
+	Deleted   bool            `json:"deleted,omitempty"`
+	Plan      json.RawMessage `json:"plan,omitempty"`
+}
+
+func key(objectId string) string {
+	return objectId + ":versions"
+}
+
+// Append queues a new version onto pipe, so it is committed together with
+// the write that produced it.
+func Append(ctx context.Context, pipe redis.Pipeliner, objectId, etag, author string, plan []byte) error {
+	data, err := json.Marshal(record{
+		ETag:      etag,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Author:    author,
+		Plan:      plan,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan version: %w", err)
+	}
+	pipe.RPush(ctx, key(objectId), data)
+	return nil
+}
+
+// AppendDelete queues a deletion marker onto pipe, so it is committed
+// together with the delete.
+func AppendDelete(ctx context.Context, pipe redis.Pipeliner, objectId, author string) error {
+	data, err := json.Marshal(record{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Author:    author,
+		Deleted:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal deletion marker: %w", err)
+	}
+	pipe.RPush(ctx, key(objectId), data)
+	return nil
+}
+
+// List returns the metadata of every version of a plan, oldest first.
+func List(ctx context.Context, objectId string) ([]models.PlanVersion, error) {
+	raw, err := config.RedisClient.LRange(ctx, key(objectId), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.PlanVersion, 0, len(raw))
+	for i, data := range raw {
+		v, err := decode(int64(i+1), data)
+		if err != nil {
+			return nil, err
+		}
+		v.Plan = nil
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// Get returns version n of a plan including its snapshot.
+func Get(ctx context.Context, objectId string, n int64) (models.PlanVersion, error) {
+	if n < 1 {
+		return models.PlanVersion{}, ErrNotFound
+	}
+	data, err := config.RedisClient.LIndex(ctx, key(objectId), n-1).Result()
+	if err == redis.Nil {
+		return models.PlanVersion{}, ErrNotFound
+	} else if err != nil {
+		return models.PlanVersion{}, err
+	}
+	return decode(n, data)
+}
+
+// AsOf returns the version of a plan that was current at t. If the plan
+// was deleted by then, that is the deletion marker.
+func AsOf(ctx context.Context, objectId string, t time.Time) (models.PlanVersion, error) {
+	raw, err := config.RedisClient.LRange(ctx, key(objectId), 0, -1).Result()
+	if err != nil {
+		return models.PlanVersion{}, err
+	}
+
+	// Versions are appended in time order, so walk back from the newest.
+	for i := len(raw) - 1; i >= 0; i-- {
+		v, err := decode(int64(i+1), raw[i])
+		if err != nil {
+			return models.PlanVersion{}, err
+		}
+		ts, err := time.Parse(time.RFC3339Nano, v.Timestamp)
+		if err != nil {
+			return models.PlanVersion{}, fmt.Errorf("corrupt timestamp on version %d: %w", v.Version, err)
+		}
+		if !ts.After(t) {
+			return v, nil
+		}
+	}
+	return models.PlanVersion{}, ErrNotFound
+}
+
+func decode(n int64, data string) (models.PlanVersion, error) {
+	var rec record
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return models.PlanVersion{}, fmt.Errorf("corrupt plan version %d: %w", n, err)
+	}
+	v := models.PlanVersion{
+		Version:   n,
+		ETag:      rec.ETag,
+		Timestamp: rec.Timestamp,
+		Author:    rec.Author,
+		Deleted:   rec.Deleted,
+	}
+	if rec.Deleted {
+		return v, nil
+	}
+
+	var plan models.Plan
+	if err := json.Unmarshal(rec.Plan, &plan); err != nil {
+		return models.PlanVersion{}, fmt.Errorf("corrupt plan snapshot %d: %w", n, err)
+	}
+	v.Plan = &plan
+	return v, nil
+}
+
+// Resolve finds a version from a reference that is either a version number
+// or an ETag (quoted or not). For ETags the newest matching version wins.
+func Resolve(ctx context.Context, objectId, ref string) (models.PlanVersion, error) {
+	if n, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return Get(ctx, objectId, n)
+	}
+
+	raw, err := config.RedisClient.LRange(ctx, key(objectId), 0, -1).Result()
+	if err != nil {
+		return models.PlanVersion{}, err
+	}
+	etag := "\"" + strings.Trim(ref, "\"") + "\""
+	for i := len(raw) - 1; i >= 0; i-- {
+		v, err := decode(int64(i+1), raw[i])
+		if err != nil {
+			return models.PlanVersion{}, err
+		}
+		if v.ETag == etag {
+			return v, nil
+		}
+	}
+	return models.PlanVersion{}, ErrNotFound
+}
+
+// Count returns how many versions a plan has.
+func Count(ctx context.Context, objectId string) (int64, error) {
+	return config.RedisClient.LLen(ctx, key(objectId)).Result()
+}
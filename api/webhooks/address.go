@@ -0,0 +1,78 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrPrivateAddress is returned for a webhook URL, or a delivery dial,
+// that points into the network the API runs in rather than at a public
+// receiver.
+var ErrPrivateAddress = errors.New("webhook address is private or internal")
+
+// reserved are ranges outside those the netip predicates cover that still
+// reach the local network or the host itself.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddr reports whether a webhook may be delivered to addr.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reserved {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL rejects a webhook URL whose host is a private address or a
+// name for this host. Other names can only be checked once they resolve,
+// which the delivery client does on every dial, so a name that resolves to
+// a private address later is still never connected to.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// dialControl is the net.Dialer Control of the delivery client. It runs
+// after the name is resolved, on the address actually dialed, so neither a
+// DNS answer nor a redirect can reach a private address.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addr) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		private bool
+	}{
+		{"https://hooks.example.com/plans", false},
+		{"https://93.184.215.14/plans", false},
+		{"https://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]/plans", false},
+		{"http://localhost:8080/hook", true},
+		{"http://LOCALHOST./hook", true},
+		{"http://api.localhost/hook", true},
+		{"http://127.0.0.1/hook", true},
+		{"http://[::1]/hook", true},
+		{"http://10.0.0.5/hook", true},
+		{"http://172.16.0.1/hook", true},
+		{"http://192.168.1.1/hook", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://[fe80::1]/hook", true},
+		{"http://[fd00::1]/hook", true},
+		{"http://[::ffff:127.0.0.1]/hook", true},
+		{"http://0.0.0.0/hook", true},
+		{"http://100.64.0.1/hook", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckURL(tt.url)
+			if got := errors.Is(err, ErrPrivateAddress); got != tt.private {
+				t.Errorf("CheckURL = %v, want private %v", err, tt.private)
+			}
+		})
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	// The test server listens on loopback, which is never dialed
+	_, err := newClient(time.Second).Post(srv.URL, "application/json", nil)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Post = %v, want ErrPrivateAddress", err)
+	}
+	if hits.Load() != 0 {
+		t.Error("the private address was reached")
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	var followed atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Only the redirect policy is under test, so dial loopback directly
+	client := newClient(time.Second)
+	client.Transport = http.DefaultTransport
+	res, err := client.Post(srv.URL+"/hook", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTemporaryRedirect || followed.Load() {
+		t.Errorf("status = %d, followed = %v, want the redirect itself", res.StatusCode, followed.Load())
+	}
+}
@@ -0,0 +1,439 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/broker"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/metrics"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Every delivery is a POST of the JSON payload with these headers. The
+// signature is the hex HMAC-SHA256, keyed with the webhook secret, of the
+// timestamp, a dot and the body, so receivers can reject replays.
+const (
+	HeaderWebhookId = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	defaultMaxAttempts  = 5
+	defaultRetryBackoff = time.Second
+	defaultTimeout      = 10 * time.Second
+	maxRetryBackoff     = 30 * time.Second
+	defaultPollInterval = time.Second
+	defaultWorkers      = 16
+)
+
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// payload is what a webhook receives: the event envelope and its type.
+type payload struct {
+	Type string `json:"type"`
+	models.PlanMessage
+}
+
+// Sign returns the X-Webhook-Signature value for a delivery.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers plan events to the webhooks subscribed to them.
+// Handle only schedules the deliveries; Run makes the attempts as they fall
+// due, so a slow or dead endpoint never holds up the event queue. Failed
+// attempts are recorded in the webhook's log and retried with exponential
+// backoff, WEBHOOK_MAX_ATTEMPTS times in all starting WEBHOOK_RETRY_BACKOFF
+// apart.
+type Dispatcher struct {
+	client       *http.Client
+	maxAttempts  int
+	retryBackoff time.Duration
+	pollInterval time.Duration
+
+	// slots bounds the attempts in flight and wake has Run look for due
+	// attempts before the next poll
+	slots chan struct{}
+	wake  chan struct{}
+}
+
+// NewDispatcher reads its settings from the environment. WEBHOOK_TIMEOUT
+// bounds each attempt, WEBHOOK_WORKERS how many are made at once and
+// WEBHOOK_POLL_INTERVAL how often the schedule is checked.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		client:       newClient(config.DurationFromEnv("WEBHOOK_TIMEOUT", defaultTimeout)),
+		maxAttempts:  config.IntFromEnv("WEBHOOK_MAX_ATTEMPTS", defaultMaxAttempts),
+		retryBackoff: config.DurationFromEnv("WEBHOOK_RETRY_BACKOFF", defaultRetryBackoff),
+		pollInterval: config.DurationFromEnv("WEBHOOK_POLL_INTERVAL", defaultPollInterval),
+		slots:        make(chan struct{}, config.IntFromEnv("WEBHOOK_WORKERS", defaultWorkers)),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// newClient returns the delivery client. It only dials public addresses,
+// and does not follow redirects, which would carry the signature headers
+// wherever the receiver sends them; a redirect is a failed attempt.
+func newClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would dial the receiver on our behalf, past dialControl
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}).DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Handle is a broker.Handler. It schedules a delivery of the event to
+// every webhook subscribed to it and returns without waiting for them. It
+// fails when the webhooks cannot be read or the deliveries not scheduled.
+func (d *Dispatcher) Handle(ctx context.Context, msg broker.Message) error {
+	hooks, err := List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	body, err := json.Marshal(payload{Type: msg.Event.EventType(), PlanMessage: msg.Event})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	var jobs []job
+	for _, w := range hooks {
+		if Matches(w, msg.Event) {
+			jobs = append(jobs, newJob(ctx, w.Id, msg.Event.EventId, body))
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	if err := schedule(ctx, time.Now(), jobs...); err != nil {
+		return fmt.Errorf("failed to schedule webhook deliveries: %w", err)
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Redeliver sends the payload of an earlier delivery again, once, and
+// returns the new delivery.
+func (d *Dispatcher) Redeliver(ctx context.Context, webhookId, deliveryId string) (models.WebhookDelivery, error) {
+	w, err := Get(ctx, webhookId)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	original, err := GetDelivery(ctx, webhookId, deliveryId)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	var event payload
+	if err := json.Unmarshal(original.Payload, &event); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("corrupt payload on delivery %s: %w", deliveryId, err)
+	}
+	delivery, _ := d.deliver(ctx, w, event.PlanMessage, original.Payload)
+	delivery.Attempts = 1
+	delivery.Redelivery = true
+	finish(ctx, delivery)
+	delivery.ID = record(ctx, delivery)
+	return delivery, nil
+}
+
+// Run makes the scheduled attempts as they fall due until ctx is
+// cancelled, then waits for the attempts in flight. Any number of
+// dispatchers, in any number of processes, can share the schedule.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var inflight sync.WaitGroup
+	defer inflight.Wait()
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	for {
+		started, err := d.runDue(ctx, &inflight)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to read the webhook delivery schedule", "error", err)
+		}
+		// A full batch means more may be due already
+		if started == dueBatch && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// runDue starts an attempt for every job that is due, as slots free up,
+// and returns how many it started.
+func (d *Dispatcher) runDue(ctx context.Context, inflight *sync.WaitGroup) (int, error) {
+	ids, err := due(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	started := 0
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			return started, nil
+		case d.slots <- struct{}{}:
+		}
+		// The lease outlasts the attempt, so nobody else makes it meanwhile,
+		// and expires if this process dies before settling the job
+		claimed, err := claim(ctx, id, time.Now(), d.client.Timeout+leaseMargin)
+		if err != nil || !claimed {
+			<-d.slots
+			if err != nil {
+				return started, err
+			}
+			continue
+		}
+		started++
+		inflight.Add(1)
+		go func() {
+			defer inflight.Done()
+			defer func() { <-d.slots }()
+			d.attempt(id)
+		}()
+	}
+	return started, nil
+}
+
+// attempt makes the next attempt of a claimed job and then retires it or
+// schedules the one after. It is not bound to Run's context, so shutdown
+// does not cut off a request halfway.
+func (d *Dispatcher) attempt(id string) {
+	j, err := loadJob(context.Background(), id)
+	if err == redis.Nil {
+		// Retired since it was claimed, so only the schedule entry is left
+		if err := retire(context.Background(), id); err != nil {
+			slog.Error("Failed to drop webhook delivery", "job", id, "error", err)
+		}
+		return
+	} else if errors.Is(err, errCorruptJob) {
+		slog.Error("Failed to load webhook delivery, dropping it", "job", id, "error", err)
+		if err := retire(context.Background(), id); err != nil {
+			slog.Error("Failed to drop webhook delivery", "job", id, "error", err)
+		}
+		return
+	} else if err != nil {
+		// Left alone, the job falls due again when its lease runs out
+		slog.Error("Failed to load webhook delivery", "job", id, "error", err)
+		return
+	}
+	ctx := j.context()
+
+	w, err := Get(ctx, j.WebhookId)
+	if errors.Is(err, ErrNotFound) {
+		slog.InfoContext(ctx, "Webhook deleted, dropping its delivery", "webhookId", j.WebhookId, "eventId", j.EventId)
+		if err := retire(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "Failed to drop webhook delivery", "job", id, "error", err)
+		}
+		return
+	} else if err != nil {
+		// Left alone, the job falls due again when its lease runs out
+		slog.ErrorContext(ctx, "Failed to read webhook", "webhookId", j.WebhookId, "error", err)
+		return
+	}
+
+	var event payload
+	if err := json.Unmarshal(j.Payload, &event); err != nil {
+		slog.ErrorContext(ctx, "Corrupt webhook payload, dropping it", "job", id, "error", err)
+		if err := retire(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "Failed to drop webhook delivery", "job", id, "error", err)
+		}
+		return
+	}
+
+	delivery, retryable := d.deliver(ctx, w, event.PlanMessage, j.Payload)
+	j.Attempts++
+	delivery.Attempts = j.Attempts
+
+	if !delivery.Succeeded && retryable && j.Attempts < d.maxAttempts {
+		backoff := d.backoff(j.Attempts)
+		next := time.Now().Add(backoff)
+		delivery.NextAttemptAt = next.UTC().Format(time.RFC3339Nano)
+		record(ctx, delivery)
+		slog.WarnContext(ctx, "Webhook delivery failed, retrying", "webhookId", w.Id, "eventId", event.EventId,
+			"attempt", j.Attempts, "status", delivery.StatusCode, "in", backoff, "error", delivery.Error)
+		if err := schedule(ctx, next, j); err != nil {
+			slog.ErrorContext(ctx, "Failed to schedule webhook retry", "job", id, "error", err)
+		}
+		return
+	}
+
+	finish(ctx, delivery)
+	record(ctx, delivery)
+	if err := retire(ctx, id); err != nil {
+		slog.ErrorContext(ctx, "Failed to retire webhook delivery", "job", id, "error", err)
+	}
+}
+
+// backoff is how long to wait after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.retryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
+// deliver makes one attempt to POST body to w, and reports whether a
+// failure is worth retrying: network errors, 5xx and 429 are, other
+// responses are final.
+func (d *Dispatcher) deliver(ctx context.Context, w models.Webhook, event models.PlanMessage, body []byte) (models.WebhookDelivery, bool) {
+	delivery := models.WebhookDelivery{
+		WebhookId: w.Id,
+		EventId:   event.EventId,
+		EventType: event.EventType(),
+		ObjectId:  event.Plan.ObjectId,
+		Payload:   body,
+	}
+
+	status, err := d.post(ctx, w, event, body)
+	delivery.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	delivery.StatusCode = status
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	delivery.Succeeded = err == nil && status >= 200 && status < 300
+	// A private address is not worth another attempt
+	if errors.Is(err, ErrPrivateAddress) {
+		return delivery, false
+	}
+	return delivery, err != nil || status >= 500 || status == http.StatusTooManyRequests
+}
+
+// finish counts a delivery that will not be attempted again.
+func finish(ctx context.Context, delivery models.WebhookDelivery) {
+	if delivery.Succeeded {
+		metrics.WebhookDeliveries.WithLabelValues("success").Inc()
+		return
+	}
+	metrics.WebhookDeliveries.WithLabelValues("failure").Inc()
+	slog.ErrorContext(ctx, "Webhook delivery failed", "webhookId", delivery.WebhookId, "eventId", delivery.EventId,
+		"attempts", delivery.Attempts, "status", delivery.StatusCode, "error", delivery.Error)
+}
+
+// post makes one delivery attempt and returns the response status.
+func (d *Dispatcher) post(ctx context.Context, w models.Webhook, event models.PlanMessage, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookId, w.Id)
+	req.Header.Set(HeaderEvent, event.EventType())
+	req.Header.Set(HeaderDelivery, event.EventId)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, body))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	return res.StatusCode, nil
+}
+
+// record appends a delivery to its webhook's log and returns its id.
+// Failures are logged, as losing a log entry must not fail the delivery.
+func record(ctx context.Context, delivery models.WebhookDelivery) string {
+	data, err := json.Marshal(delivery)
+	if err == nil {
+		var id string
+		id, err = config.RedisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: deliveryLog(delivery.WebhookId),
+			MaxLen: deliveryLogCap,
+			Approx: true,
+			Values: map[string]interface{}{"delivery": data},
+		}).Result()
+		if err == nil {
+			return id
+		}
+	}
+	slog.ErrorContext(ctx, "Failed to record webhook delivery", "webhookId", delivery.WebhookId, "eventId", delivery.EventId, "error", err)
+	return ""
+}
+
+// Deliveries returns the most recent deliveries to a webhook, newest
+// first.
+func Deliveries(ctx context.Context, webhookId string, count int64) ([]models.WebhookDelivery, error) {
+	msgs, err := config.RedisClient.XRevRangeN(ctx, deliveryLog(webhookId), "+", "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]models.WebhookDelivery, 0, len(msgs))
+	for _, msg := range msgs {
+		delivery, err := decodeDelivery(msg)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// GetDelivery returns one delivery from a webhook's log.
+func GetDelivery(ctx context.Context, webhookId, deliveryId string) (models.WebhookDelivery, error) {
+	msgs, err := config.RedisClient.XRange(ctx, deliveryLog(webhookId), deliveryId, deliveryId).Result()
+	if err != nil {
+		// A malformed id is a reply error from Redis, not a failure
+		var redisErr redis.Error
+		if errors.As(err, &redisErr) {
+			return models.WebhookDelivery{}, ErrDeliveryNotFound
+		}
+		return models.WebhookDelivery{}, err
+	}
+	if len(msgs) == 0 {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	return decodeDelivery(msgs[0])
+}
+
+func decodeDelivery(msg redis.XMessage) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	raw, _ := msg.Values["delivery"].(string)
+	if err := json.Unmarshal([]byte(raw), &delivery); err != nil {
+		return delivery, fmt.Errorf("corrupt webhook delivery %s: %w", msg.ID, err)
+	}
+	delivery.ID = msg.ID
+	return delivery, nil
+}
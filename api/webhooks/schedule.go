@@ -0,0 +1,135 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/logging"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Pending deliveries are jobs kept in a hash, and scheduled in a sorted
+// set scored by when their next attempt is due. A dispatcher claims a due
+// job by pushing its score out by a lease, so a job whose dispatcher dies
+// mid-attempt falls due again instead of being lost.
+const (
+	scheduleKey = "webhooks:schedule"
+	jobsKey     = "webhooks:schedule:jobs"
+
+	dueBatch    = 100
+	leaseMargin = 30 * time.Second
+)
+
+var errCorruptJob = errors.New("corrupt webhook job")
+
+// claimScript moves a job that is due (ARGV[2]) to the end of its lease
+// (ARGV[3]) and reports whether it did.
+var claimScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// job is the delivery of one event to one webhook, with the attempts made
+// so far and the trace and request ID of the event, which its attempts
+// carry on.
+type job struct {
+	WebhookId string            `json:"webhookId"`
+	EventId   string            `json:"eventId"`
+	Attempts  int               `json:"attempts"`
+	Payload   json.RawMessage   `json:"payload"`
+	Trace     map[string]string `json:"trace,omitempty"`
+	RequestId string            `json:"requestId,omitempty"`
+}
+
+func newJob(ctx context.Context, webhookId, eventId string, body []byte) job {
+	j := job{
+		WebhookId: webhookId,
+		EventId:   eventId,
+		Payload:   body,
+		Trace:     map[string]string{},
+		RequestId: logging.RequestID(ctx),
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(j.Trace))
+	return j
+}
+
+// id is unique per event and webhook, so scheduling an event again, when
+// the broker redelivers it, replaces its jobs instead of adding to them.
+func (j job) id() string {
+	return j.EventId + ":" + j.WebhookId
+}
+
+// context continues the trace and request ID the job was scheduled with.
+func (j job) context() context.Context {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(j.Trace))
+	if j.RequestId != "" {
+		ctx = logging.WithRequestID(ctx, j.RequestId)
+	}
+	return ctx
+}
+
+// schedule saves jobs with their next attempt due at.
+func schedule(ctx context.Context, at time.Time, jobs ...job) error {
+	_, err := config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, j := range jobs {
+			data, err := json.Marshal(j)
+			if err != nil {
+				return fmt.Errorf("failed to marshal webhook job: %w", err)
+			}
+			pipe.HSet(ctx, jobsKey, j.id(), data)
+			pipe.ZAdd(ctx, scheduleKey, redis.Z{Score: float64(at.UnixMilli()), Member: j.id()})
+		}
+		return nil
+	})
+	return err
+}
+
+// due returns the ids of up to dueBatch jobs due by now, earliest first.
+func due(ctx context.Context, now time.Time) ([]string, error) {
+	return config.RedisClient.ZRangeByScore(ctx, scheduleKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: dueBatch,
+	}).Result()
+}
+
+// claim leases a due job for lease, and reports false when it is no longer
+// due because another dispatcher claimed or retired it first.
+func claim(ctx context.Context, id string, now time.Time, lease time.Duration) (bool, error) {
+	claimed, err := claimScript.Run(ctx, config.RedisClient, []string{scheduleKey},
+		id, now.UnixMilli(), now.Add(lease).UnixMilli()).Int()
+	return claimed == 1, err
+}
+
+func loadJob(ctx context.Context, id string) (job, error) {
+	var j job
+	data, err := config.RedisClient.HGet(ctx, jobsKey, id).Result()
+	if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal([]byte(data), &j); err != nil {
+		return j, fmt.Errorf("%w %s: %v", errCorruptJob, id, err)
+	}
+	return j, nil
+}
+
+// retire removes a job that will not be attempted again.
+func retire(ctx context.Context, id string) error {
+	_, err := config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, scheduleKey, id)
+		pipe.HDel(ctx, jobsKey, id)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,142 @@
+package webhooks
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dumbresi/Healthcare-Plan-Management/api/config"
+	"github.com/dumbresi/Healthcare-Plan-Management/api/models"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Webhooks are stored as JSON in one hash keyed by id, which the
+// dispatcher reads in full for every event. Each webhook's delivery log is
+// a capped stream, like the audit trail.
+const (
+	hashKey        = "webhooks"
+	deliveryLogFmt = "webhook:%s:deliveries"
+	deliveryLogCap = 1000
+)
+
+// EventTypes are the events a webhook can subscribe to.
+var EventTypes = []string{models.EventPlanCreated, models.EventPlanPatched, models.EventPlanDeleted}
+
+var ErrNotFound = errors.New("webhook not found")
+
+func deliveryLog(id string) string {
+	return fmt.Sprintf(deliveryLogFmt, id)
+}
+
+// Create stores a new webhook, generating its id and, when none was
+// given, its secret.
+func Create(ctx context.Context, w models.Webhook) (models.Webhook, error) {
+	w.Id = uuid.NewString()
+	w.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	w.UpdatedAt = ""
+	if w.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return w, err
+		}
+		w.Secret = secret
+	}
+	return w, save(ctx, w)
+}
+
+// Update replaces the URL and filters of a webhook. The secret is only
+// replaced when a new one is given.
+func Update(ctx context.Context, id string, update models.Webhook) (models.Webhook, error) {
+	w, err := Get(ctx, id)
+	if err != nil {
+		return w, err
+	}
+	w.URL = update.URL
+	w.Events = update.Events
+	w.Org = update.Org
+	if update.Secret != "" {
+		w.Secret = update.Secret
+	}
+	w.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return w, save(ctx, w)
+}
+
+func save(ctx context.Context, w models.Webhook) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook: %w", err)
+	}
+	return config.RedisClient.HSet(ctx, hashKey, w.Id, data).Err()
+}
+
+// Get returns a webhook including its secret.
+func Get(ctx context.Context, id string) (models.Webhook, error) {
+	var w models.Webhook
+	data, err := config.RedisClient.HGet(ctx, hashKey, id).Result()
+	if err == redis.Nil {
+		return w, ErrNotFound
+	} else if err != nil {
+		return w, err
+	}
+	if err := json.Unmarshal([]byte(data), &w); err != nil {
+		return w, fmt.Errorf("corrupt webhook %s: %w", id, err)
+	}
+	return w, nil
+}
+
+// List returns every webhook including its secret, oldest first.
+func List(ctx context.Context) ([]models.Webhook, error) {
+	all, err := config.RedisClient.HGetAll(ctx, hashKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]models.Webhook, 0, len(all))
+	for id, data := range all {
+		var w models.Webhook
+		if err := json.Unmarshal([]byte(data), &w); err != nil {
+			return nil, fmt.Errorf("corrupt webhook %s: %w", id, err)
+		}
+		list = append(list, w)
+	}
+	slices.SortFunc(list, func(a, b models.Webhook) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), cmp.Compare(a.Id, b.Id))
+	})
+	return list, nil
+}
+
+// Delete removes a webhook and its delivery log.
+func Delete(ctx context.Context, id string) error {
+	pipe := config.RedisClient.TxPipeline()
+	removed := pipe.HDel(ctx, hashKey, id)
+	pipe.Del(ctx, deliveryLog(id))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if removed.Val() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Matches reports whether w subscribes to event.
+func Matches(w models.Webhook, event models.PlanMessage) bool {
+	if len(w.Events) > 0 && !slices.Contains(w.Events, event.EventType()) {
+		return false
+	}
+	return w.Org == "" || w.Org == event.Plan.Org
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}